@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/xernobyl/mesh2distance/src/sdf"
+)
+
+// Output of the command line tool, the progress and messages of the bake plus its own
+type logger interface {
+	sdf.Logger
+
+	// Error is why the tool stopped
+	Error(text string)
+
+	// Done is called once everything is written
+	Done(outputs []output)
+
+	// Err is the first error writing the log, nil when there was none
+	Err() error
+}
+
+// Files written for one result
+type output struct {
+	JSON     string         `json:"json"`
+	Metadata map[string]any `json:"metadata"` // Includes the paths of the texture and volumes
+	Snippet  string         `json:"snippet,omitempty"`
+}
+
+// Prints everything on stdout, for people, and errors on stderr
+type textLogger struct {
+	sdf.StdoutLogger
+}
+
+func (l *textLogger) Error(text string) {
+	fmt.Fprintln(os.Stderr, text)
+}
+
+func (l *textLogger) Done(outputs []output) {
+	for _, o := range outputs {
+		if o.Snippet != "" {
+			fmt.Printf("\n%s", o.Snippet)
+		}
+	}
+
+	fmt.Println("All done. Bye.")
+}
+
+func (l *textLogger) Err() error {
+	return nil
+}
+
+/*
+Writes one json object per event, for build scripts. Events have an "event"
+field with one of "stage_start", "progress", "stage_end", "message", "warning",
+"error" or "summary". Done also prints the outputs as one json object on
+out, so it's the only thing there. The first error writing either is kept
+for Err, and nothing else is written after it.
+*/
+type jsonLogger struct {
+	encoder  *json.Encoder
+	out      io.Writer
+	start    time.Time
+	percent  int
+	warnings int
+	err      error
+}
+
+func newJSONLogger(events, out io.Writer) *jsonLogger {
+	return &jsonLogger{encoder: json.NewEncoder(events), out: out, start: time.Now()}
+}
+
+func (l *jsonLogger) event(event string, fields map[string]any) {
+	if l.err != nil {
+		return
+	}
+
+	fields["event"] = event
+	l.err = l.encoder.Encode(fields)
+}
+
+func (l *jsonLogger) Progress(stage string, done, total int) {
+	if done == 0 {
+		l.event("stage_start", map[string]any{"stage": stage, "total": total})
+		l.percent = 0
+	}
+
+	// One event per percent is plenty
+	percent := done * 100 / max(total, 1)
+	if percent != l.percent {
+		l.percent = percent
+		l.event("progress", map[string]any{"stage": stage, "done": done, "total": total})
+	}
+
+	if done == total {
+		l.event("stage_end", map[string]any{"stage": stage, "total": total})
+	}
+}
+
+func (l *jsonLogger) Message(text string) {
+	l.event("message", map[string]any{"text": text})
+}
+
+func (l *jsonLogger) Warning(text string, triangle int) {
+	l.warnings++
+
+	fields := map[string]any{"text": text}
+	if triangle >= 0 {
+		fields["triangle"] = triangle
+	}
+
+	l.event("warning", fields)
+}
+
+func (l *jsonLogger) Error(text string) {
+	l.event("error", map[string]any{"text": text})
+}
+
+func (l *jsonLogger) Done(outputs []output) {
+	l.event("summary", map[string]any{
+		"outputs":  len(outputs),
+		"warnings": l.warnings,
+		"seconds":  time.Since(l.start).Seconds(),
+	})
+
+	if l.err != nil {
+		return
+	}
+
+	encoder := json.NewEncoder(l.out)
+	encoder.SetIndent("", "  ")
+	l.err = encoder.Encode(map[string]any{"outputs": outputs})
+}
+
+func (l *jsonLogger) Err() error {
+	return l.err
+}
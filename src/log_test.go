@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var events, out bytes.Buffer
+	log := newJSONLogger(&events, &out)
+
+	log.Progress("Calculating distance field", 0, 200)
+	log.Progress("Calculating distance field", 100, 200)
+	log.Progress("Calculating distance field", 200, 200)
+	log.Message("Output resolution: 16 x 16 x 16")
+	log.Warning("mesh is not closed", 3)
+	log.Warning("no texels inside", -1)
+	log.Error("Error baking mesh")
+	log.Done([]output{{JSON: "a.json", Metadata: map[string]any{"texture_width": 16}}})
+	assert.NoError(t, log.Err())
+
+	// One json object per line
+	var decoded []map[string]any
+	for _, line := range strings.Split(strings.TrimSuffix(events.String(), "\n"), "\n") {
+		var event map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &event), line)
+		decoded = append(decoded, event)
+	}
+
+	expected := []map[string]any{
+		{"event": "stage_start", "stage": "Calculating distance field", "total": 200.0},
+		{"event": "progress", "stage": "Calculating distance field", "done": 100.0, "total": 200.0},
+		{"event": "progress", "stage": "Calculating distance field", "done": 200.0, "total": 200.0},
+		{"event": "stage_end", "stage": "Calculating distance field", "total": 200.0},
+		{"event": "message", "text": "Output resolution: 16 x 16 x 16"},
+		{"event": "warning", "text": "mesh is not closed", "triangle": 3.0},
+		{"event": "warning", "text": "no texels inside"},
+		{"event": "error", "text": "Error baking mesh"},
+	}
+
+	if !assert.Len(t, decoded, len(expected)+1) {
+		return
+	}
+	assert.Equal(t, expected, decoded[:len(expected)])
+
+	summary := decoded[len(expected)]
+	assert.Equal(t, "summary", summary["event"])
+	assert.Equal(t, 1.0, summary["outputs"])
+	assert.Equal(t, 2.0, summary["warnings"])
+	assert.IsType(t, 0.0, summary["seconds"])
+
+	// The outputs are a single object on their own
+	var outputs struct {
+		Outputs []output `json:"outputs"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &outputs))
+	assert.Equal(t, []output{{JSON: "a.json", Metadata: map[string]any{"texture_width": 16.0}}}, outputs.Outputs)
+}
+
+// Fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestJSONLoggerError(t *testing.T) {
+	var out bytes.Buffer
+	log := newJSONLogger(failingWriter{}, &out)
+
+	log.Message("Loading 3D model a.obj...")
+	log.Done(nil)
+	assert.EqualError(t, log.Err(), "disk full")
+	assert.Zero(t, out.Len())
+
+	log = newJSONLogger(&out, failingWriter{})
+	log.Done(nil)
+	assert.EqualError(t, log.Err(), "disk full")
+}
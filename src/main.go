@@ -1,43 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
-)
-
-// mirror modes
-type convertionOptions uint16
-
-const resLimit = 4096
-const sizeLimit = 16 * 1024 * 1024 // 16MB
 
-const (
-	convertionOptionsMirrorX              = 1 << 0
-	convertionOptionsMirrorXIncludeCenter = 1 << 1
-	convertionOptionsMirrorXNegative      = 1 << 2
-	convertionOptionsMirrorY              = 1 << 3
-	convertionOptionsMirrorYIncludeCenter = 1 << 4
-	convertionOptionsMirrorYNegative      = 1 << 5
-	convertionOptionsMirrorZ              = 1 << 6
-	convertionOptionsMirrorZIncludeCenter = 1 << 7
-	convertionOptionsMirrorZNegative      = 1 << 8
-
-	convertionOptions16bits = 1 << 9 // 16 bits output, 8 bits otherwise
+	"github.com/xernobyl/mesh2distance/src/sdf"
 )
 
-type distanceSettings struct {
-	width             uint16
-	height            uint16
-	depth             uint16
-	convertionOptions convertionOptions
+func main() {
+	os.Exit(run())
 }
 
-func main() {
+// Runs the tool, returns the exit status, 1 when something failed
+func run() int {
 	// All the options that should be available to the user:
 	// - Mirror modes, for each axis:
 	//   - none
@@ -61,167 +44,360 @@ func main() {
 	outputTypePtr := flag.Int("type", 8, "Output type, 8 or 16 bits")
 	outputResolutionPtr := flag.Int("res", 32, "Output resolution biggest side")
 	mirrorModePtr := flag.String("mirrormode", "", "Mirroring mode for each axis... format to be determined")
-	filePathPtr := flag.String("file", "bin", ".obj file path")
-	formatPtr := flag.String("format", "bin", "output file format")
+	var filePaths fileList
+	flag.Var(&filePaths, "file", ".obj or .ply file path, repeat it to pack up to four distance fields sharing one grid into the channels of one texture")
+	formatPtr := flag.String("format", "bin", "output file format: bin, dds or ktx2")
 	checkFilePtr := flag.Bool("check", false, "Do some file checks before continuing, mostly for debugging")
-	flag.Parse()
+	rangePtr := flag.String("range", "", "Fixed distance range \"min,max\" used for quantization, values outside are clamped")
+	rangeTexelsPtr := flag.Bool("rangetexels", false, "The -range values are in texels instead of world units")
+	unitsPtr := flag.String("units", "world", "Distance units, \"world\" or \"texel\" (texels of the output grid)")
+	compressPtr := flag.String("compress", "none", "Block compression, \"none\", \"bc4\" or \"bc4s\" (signed), 8 bits only")
+	brickSizePtr := flag.Int("bricks", 0, "Sparse output, split the grid in bricks of this many texels per side and keep the ones close to the surface")
+	bandPtr := flag.Float64("band", 4.0, "Bricks with no texel closer to the surface than this many texels are discarded, and texels further than this have no occlusion, thickness or curvature")
+	adfPtr := flag.Bool("adf", false, "Adaptive octree output instead of a uniform grid, the finest cells match the -res texels")
+	tolerancePtr := flag.Float64("tolerance", 0.1, "Octree cells are split when the interpolated distance is off by more than this many texels")
+	normalsPtr := flag.String("normals", "none", "Normal channels, \"none\", \"analytic\" (direction to the closest point) or \"central\" (central differences)")
+	normalPackPtr := flag.String("normalpack", "rgba", "Normal packing, \"rgba\" (normal in RGB and distance in A) or \"oct\" (octahedral RG volume next to the distance)")
+	vectorsPtr := flag.String("vectors", "none", "Closest point vector volume, \"none\", \"half\" (RGBA16F) or \"snorm\" (RGBA8/16 signed normalized)")
+	vectorSignPtr := flag.Bool("vectorsign", false, "Store the sign of the distance in the alpha channel of the vector volume")
+	trianglesPtr := flag.Bool("triangles", false, "Write raw volumes with the closest triangle index (u32) and barycentric coordinates (3 x f32) of each texel")
+	materialsPtr := flag.Bool("materials", false, "Write a volume with the material index (from usemtl, or g) of the closest triangle of each texel")
+	albedoPtr := flag.String("albedo", "none", "RGBA8 color volume, \"none\", \"texture\" (map_Kd texture of the closest point) or \"vertex\" (vertex colors of the closest point)")
+	occlusionPtr := flag.Bool("aothickness", false, "Write an RG volume with ambient occlusion and thickness for the texels near the surface")
+	curvaturePtr := flag.Bool("curvature", false, "Write a signed RG volume with the mean and Gaussian curvature for the texels near the surface")
+	mipsPtr := flag.Bool("mips", false, "Add a full mip chain, each level keeps the smallest distance of the level above")
+	batchPtr := flag.Bool("batch", false, "Bake all the .obj or .ply files given after the options using one shared distance range")
+	atlasPtr := flag.String("atlas", "atlas", "Output path, without extension, of the pack command atlas")
+	paddingPtr := flag.Int("padding", 1, "Texels around each volume in the pack command atlas, repeating its border")
+	threadsPtr := flag.Int("threads", 0, "Workers of the bake (mesh check, distances, octree, block compression and occlusion), 0 for one per CPU")
+	float32Ptr := flag.Bool("float32", false, "Calculate distances in float32, faster but less precise")
+	hybridPtr := flag.Bool("hybrid", false, "Exact distances only near the surface, the rest by fast sweeping with signs from a flood fill of the exterior")
+	hybridReportPtr := flag.Bool("hybridreport", false, "Also calculate the exact distances of a -hybrid field, and report the error")
+	supersamplePtr := flag.Int("supersample", 1, "Evaluate N^3 sub-samples spread over each texel, to stop thin features aliasing at low resolutions")
+	filterPtr := flag.String("filter", "min", "How the -supersample sub-samples are combined, \"min\" (the one closest to the surface) or \"average\"")
+	samplingPtr := flag.String("sampling", "corner", "Where the texels are in the grid bounding box of the json, \"corner\" (the first and last texels are on the box) or \"center\" (the box is the outside of the texels)")
+	signPtr := flag.String("sign", "triangles", "Signs of the distances, \"triangles\" (normal of the closest triangle) or \"floodfill\" (flood fill of the exterior, for meshes with inconsistent winding)")
+	logPtr := flag.String("log", "text", "Output, \"text\" on stdout, or \"json\" events, one per line, on stderr and a json object describing the results on stdout")
+
+	// "mesh2distance pack [options] files..." bakes the files into one atlas
+	packAtlas := len(os.Args) > 1 && os.Args[1] == "pack"
+	if packAtlas {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+
+	var log logger
+	switch *logPtr {
+	case "text":
+		log = &textLogger{}
+	case "json":
+		log = newJSONLogger(os.Stderr, os.Stdout)
+	default:
+		fmt.Fprintln(os.Stderr, "Invalid log output.")
+		return 1
+	}
+
+	options := sdf.Options{
+		Resolution:   *outputResolutionPtr,
+		Type:         sdf.Type(*outputTypePtr),
+		Format:       sdf.Format(*formatPtr),
+		Units:        sdf.Units(*unitsPtr),
+		RangeTexels:  *rangeTexelsPtr,
+		Mips:         *mipsPtr,
+		Compress:     sdf.Compression(*compressPtr),
+		BrickSize:    *brickSizePtr,
+		Band:         *bandPtr,
+		ADF:          *adfPtr,
+		Tolerance:    *tolerancePtr,
+		Normals:      sdf.Normals(*normalsPtr),
+		NormalPack:   sdf.NormalPack(*normalPackPtr),
+		Vectors:      sdf.Vectors(*vectorsPtr),
+		VectorSign:   *vectorSignPtr,
+		Triangles:    *trianglesPtr,
+		Materials:    *materialsPtr,
+		Albedo:       sdf.Albedo(*albedoPtr),
+		Occlusion:    *occlusionPtr,
+		Curvature:    *curvaturePtr,
+		Sign:         sdf.Sign(*signPtr),
+		Threads:      *threadsPtr,
+		Float32:      *float32Ptr,
+		Hybrid:       *hybridPtr,
+		HybridReport: *hybridReportPtr,
+		Progress:     log,
+
+		Sampling:          sdf.Sampling(*samplingPtr),
+		Supersample:       *supersamplePtr,
+		SupersampleFilter: sdf.Filter(*filterPtr),
+	}
+
+	mirror, err := sdf.ParseMirror(*mirrorModePtr)
+	if err != nil {
+		log.Error("Invalid mirror mode.")
+		return 1
+	}
+	options.Mirror = mirror
 
-	distanceSettings := distanceSettings{}
+	if *rangePtr != "" {
+		rangeMin, rangeMax, err := parseRange(*rangePtr)
+		if err != nil {
+			log.Error(fmt.Sprint("Invalid range: ", err))
+			return 1
+		}
+		options.Range = sdf.Range{Min: rangeMin, Max: rangeMax}
+	}
+
+	if err := options.Validate(); err != nil {
+		log.Error(fmt.Sprint("Invalid options: ", err))
+		return 1
+	}
+
+	files := []string(filePaths)
+	if *batchPtr || packAtlas {
+		files = flag.Args()
+		if len(files) == 0 || len(filePaths) > 0 {
+			log.Error("Batch mode and the pack command need a list of .obj or .ply files after the options, and no -file.")
+			return 1
+		}
+	}
 
-	if *outputTypePtr != 8 && *outputTypePtr != 16 {
-		fmt.Println("Output type must be 8 or 16")
-		return
+	if len(files) == 0 {
+		log.Error("Needs a .obj or .ply file.")
+		return 1
 	}
 
-	if *outputResolutionPtr < 16 && *outputResolutionPtr > resLimit {
-		fmt.Printf("Output resolution must be between 16 and %d.\n", resLimit)
-		return
+	// Several -file inputs are packed into the channels of one texture
+	packChannels := len(files) > 1 && !*batchPtr && !packAtlas
+
+	if packChannels && len(files) > 4 {
+		log.Error("Up to four files can be packed into the channels of one texture")
+		return 1
 	}
 
-	if *formatPtr != "bin" && *formatPtr != "dds" {
-		fmt.Println("Output format must be \"bin\" or \"dds\"")
-		return
+	if (packChannels || packAtlas) && !options.Packable() {
+		log.Error("Files packed into channels or an atlas can't be used with bricks, octrees, mips, block compression, normals or companion volumes")
+		return 1
 	}
 
-	if *outputTypePtr == 16 {
-		distanceSettings.convertionOptions |= convertionOptions16bits
+	// Ctrl-C stops the bake at the next row
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var meshes []*sdf.Mesh
+
+	for _, path := range files {
+		mesh, err := loadMesh(path, *checkFilePtr, *threadsPtr, log)
+		if err != nil {
+			log.Error(fmt.Sprint("Error loading mesh: ", err))
+			return 1
+		}
+
+		meshes = append(meshes, mesh)
 	}
 
-	reMirror := regexp.MustCompile(`^(-?x?i?)(-?y?i?)(-?z?i?)$`)
+	// Packed meshes share one grid that fits all of them
+	if packChannels {
+		options.BoundsMin, options.BoundsMax = sdf.UnionBounds(meshes)
+	}
 
-	// Parse mirror modes (-xi, x, xi)
-	if matches := reMirror.FindStringSubmatch(*mirrorModePtr); matches != nil {
-		fmt.Printf("X mirror mode: \"%s\"\n", matches[1])
-		fmt.Printf("Y mirror mode: \"%s\"\n", matches[2])
-		fmt.Printf("Z mirror mode: \"%s\"\n", matches[3])
+	var results []*sdf.Result
+	var outputs []output
 
-		switch matches[1] {
-		case "x":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorX
-		case "-x":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorXNegative
-			distanceSettings.convertionOptions |= convertionOptionsMirrorX
-		case "xi":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorX
-			distanceSettings.convertionOptions |= convertionOptionsMirrorXIncludeCenter
-		case "-xi":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorXNegative
-			distanceSettings.convertionOptions |= convertionOptionsMirrorX
-			distanceSettings.convertionOptions |= convertionOptionsMirrorXIncludeCenter
+	for _, mesh := range meshes {
+		r, err := sdf.Calculate(ctx, mesh, options)
+		if err != nil {
+			log.Error(fmt.Sprint("Error baking mesh: ", err))
+			return 1
 		}
 
-		switch matches[2] {
-		case "y":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorY
-		case "-y":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorYNegative
-			distanceSettings.convertionOptions |= convertionOptionsMirrorY
-		case "yi":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorY
-			distanceSettings.convertionOptions |= convertionOptionsMirrorYIncludeCenter
-		case "-yi":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorYNegative
-			distanceSettings.convertionOptions |= convertionOptionsMirrorY
-			distanceSettings.convertionOptions |= convertionOptionsMirrorYIncludeCenter
+		results = append(results, r)
+	}
+
+	// A shared range means every output decodes with the same constants
+	sharedMin, sharedMax := sdf.SharedRange(results)
+
+	for _, r := range results {
+		minD, maxD := r.MinD, r.MaxD
+		if *batchPtr && *rangePtr == "" {
+			minD, maxD = sharedMin, sharedMax
 		}
 
-		switch matches[3] {
-		case "z":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZ
-		case "-z":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZNegative
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZ
-		case "zi":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZ
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZIncludeCenter
-		case "-zi":
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZNegative
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZ
-			distanceSettings.convertionOptions |= convertionOptionsMirrorZIncludeCenter
+		if err := r.Encode(ctx, minD, maxD); err != nil {
+			log.Error(fmt.Sprint("Error baking mesh: ", err))
+			return 1
 		}
-	} else {
-		fmt.Println("Invalid mirror mode.")
-		return
 	}
 
-	fmt.Println("Loading 3D model...")
+	switch {
+	case packChannels:
+		packed, err := sdf.PackChannels(results)
+		if err == nil {
+			for i, channel := range packed.Metadata["channels"].([]map[string]any) {
+				channel["mesh"] = files[i]
+			}
+
+			var o output
+			o, err = writeResult(packed, pathNoExt(files[0])+"_channels", options.Format, log)
+			outputs = append(outputs, o)
+		}
+
+		if err != nil {
+			log.Error(fmt.Sprint("Error saving file: ", err))
+			return 1
+		}
 
-	mesh, err := LoadOBJ(*filePathPtr)
+	case packAtlas:
+		atlas, err := sdf.PackAtlas(results, *paddingPtr)
+		if err == nil {
+			for i, asset := range atlas.Metadata["assets"].([]map[string]any) {
+				asset["mesh"] = files[i]
+			}
+
+			var o output
+			o, err = writeResult(atlas, *atlasPtr, options.Format, log)
+			outputs = append(outputs, o)
+		}
+
+		if err != nil {
+			log.Error(fmt.Sprint("Error saving file: ", err))
+			return 1
+		}
+
+	default:
+		for i, r := range results {
+			o, err := writeResult(r, pathNoExt(files[i]), options.Format, log)
+			if err != nil {
+				log.Error(fmt.Sprint("Error saving file: ", err))
+				return 1
+			}
+			outputs = append(outputs, o)
+		}
+	}
+
+	log.Done(outputs)
+
+	if err := log.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing the log:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Values of a flag that can be repeated
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Parses a "min,max" distance range
+func parseRange(s string) (float64, float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected \"min,max\", got \"%s\"", s)
+	}
+
+	rangeMin, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
 	if err != nil {
-		fmt.Println("Error loading mesh:", err)
-		return
+		return 0, 0, err
 	}
 
-	// Do some weird checks on file, mostly for debugging
-	if checkFilePtr != nil && *checkFilePtr {
-		fmt.Println("Verifying mesh...")
-		mesh.fixTriangles()
+	rangeMax, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	w, h, d, gridMin, gridMax := calculateGridSize(mesh.Min, mesh.Max, *outputResolutionPtr)
-	fmt.Printf("Output resolution: %d x %d x %d\n", w, h, d)
+	if rangeMin >= rangeMax {
+		return 0, 0, fmt.Errorf("min must be smaller than max")
+	}
 
-	if (w * h * d) > sizeLimit {
-		fmt.Printf("Output size is too big (%d), maximum allowed is %d bytes.\n", w*h*d, sizeLimit)
-		return
+	return rangeMin, rangeMax, nil
+}
+
+// Path without the extension
+func pathNoExt(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// Loads a mesh, and checks it if asked to
+func loadMesh(path string, check bool, threads int, log logger) (*sdf.Mesh, error) {
+	log.Message(fmt.Sprintf("Loading 3D model %s...", path))
+
+	mesh, err := sdf.LoadMesh(path)
+	if err != nil {
+		return nil, err
 	}
 
-	distanceSettings.width = uint16(w)
-	distanceSettings.height = uint16(h)
-	distanceSettings.depth = uint16(d)
+	// Do some weird checks on file, mostly for debugging
+	if check {
+		log.Message("Verifying mesh...")
+		mesh.FixTriangles(threads)
+	}
 
-	data, minD, maxD := calculate(distanceSettings, *mesh, gridMin, gridMax)
+	log.Message(fmt.Sprintf("%d triangles", len(mesh.Triangles)))
+	for _, warning := range mesh.Warnings {
+		log.Warning(warning.Text, warning.Triangle)
+	}
 
-	fmt.Println("Writing files...")
+	return mesh, nil
+}
 
-	ext := filepath.Ext(*filePathPtr)
-	pathNoExt := strings.TrimSuffix(*filePathPtr, ext)
+// Writes the texture and volumes of a result, named after pathNoExt, and the json file describing them
+func writeResult(r *sdf.Result, pathNoExt string, format sdf.Format, log logger) (output, error) {
+	log.Message("Writing files...")
 
-	if *formatPtr == "dds" {
-		Save3DTextureAsDDS(
-			pathNoExt+".dds",
-			data,
-			uint32(distanceSettings.width),
-			uint32(distanceSettings.height),
-			uint32(distanceSettings.depth),
-			uint32(*outputTypePtr),
-		)
-	} else {
-		err = os.WriteFile(pathNoExt+".bin", data, 0644)
-		if err != nil {
-			fmt.Println("Error saving file:", err)
-			return
+	path := pathNoExt + "." + r.Texture.Extension(format)
+	if err := writeVolume(path, &r.Texture, format); err != nil {
+		return output{}, err
+	}
+	r.Metadata["texture_data"] = path
+
+	for i := range r.Volumes {
+		v := &r.Volumes[i]
+		path := fmt.Sprintf("%s_%s.%s", pathNoExt, v.Name, v.Extension(format))
+
+		if err := writeVolume(path, v, format); err != nil {
+			return output{}, err
 		}
+		r.Metadata[v.Name+"_data"] = path
 	}
 
-	jsonData, err := json.MarshalIndent(map[string]any{
-		"distance_min":          minD,
-		"distance_max":          maxD,
-		"texture_width":         distanceSettings.width,
-		"texture_height":        distanceSettings.height,
-		"texture_depth":         distanceSettings.depth,
-		"mesh_bounding_box_min": mesh.Min,
-		"mesh_bounding_box_max": mesh.Max,
-		"grid_bounding_box_min": gridMin,
-		"grid_bounding_box_max": gridMax,
-		"texture_data":          pathNoExt + "." + *formatPtr,
-		"texture_format":        fmt.Sprintf("u%d", *outputTypePtr),
-	}, "", "  ")
-	if err != nil {
-		panic(err)
+	o := output{JSON: pathNoExt + ".json", Metadata: r.Metadata, Snippet: r.Snippet()}
+	if err := writeJSON(o.JSON, r.Metadata); err != nil {
+		return output{}, err
 	}
 
-	// Write JSON to file
-	err = os.WriteFile(pathNoExt+".json", jsonData, 0644)
+	return o, nil
+}
+
+// Writes a volume file
+func writeVolume(path string, v *sdf.Volume, format sdf.Format) error {
+	file, err := os.Create(path)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if err := v.Write(writer, format); err != nil {
+		return err
 	}
 
-	fmt.Println("All done. Bye.")
+	return writer.Flush()
+}
+
+// Writes the json description of an output
+func writeJSON(path string, info map[string]any) error {
+	jsonData, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("\nmodel(vec3(%f, %f, %f),\n\tvec3(%f, %f, %f),\n\t%f,\n\t%f);\n",
-		gridMin[0], gridMin[1], gridMin[2],
-		gridMax[0], gridMax[1], gridMax[2],
-		minD,
-		maxD)
+	return os.WriteFile(path, jsonData, 0644)
 }
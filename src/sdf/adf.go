@@ -0,0 +1,386 @@
+package sdf
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+/*
+Adaptive distance field. An octree over a cube, where each leaf stores the
+distances at its 8 corners and is sampled with trilinear interpolation. Cells are
+only subdivided where the interpolation is off by more than the tolerance.
+
+Binary layout, little endian:
+
+	offset  size  contents
+	0       4     magic "ADF1"
+	4       4     uint32 node count N
+	8       4     uint32 leaf count L
+	12      12    float32[3] root cube min corner
+	24      4     float32 root cube side
+	28      4*N   uint32 nodes, node 0 is the root
+	28+4*N  32*L  float32[8] corner distances of each leaf
+
+If the top bit of a node is set the low 31 bits are a leaf index, otherwise they
+are the index of the first of its 8 children, which are consecutive. Children
+and corners are ordered by x + 2*y + 4*z, x being the lowest bit.
+*/
+type ADF struct {
+	rootMin  vec.Vec3
+	rootSize float64
+	nodes    []uint32
+	corners  []float32
+}
+
+const adfMagic = 0x31464441 // "ADF1"
+const adfLeaf = 1 << 31
+
+// First 28 bytes of the binary format
+type adfHeader struct {
+	Magic     uint32
+	NodeCount uint32
+	LeafCount uint32
+	RootMin   [3]float32
+	RootSize  float32
+}
+
+// Octree node while building, flattened once complete
+type adfCell struct {
+	corners  [8]float64
+	children *[8]adfCell
+}
+
+// Offset of the corner or child i, in [0, 1]
+func adfOffset(i int) vec.Vec3 {
+	return vec.Vec3{float64(i & 1), float64((i >> 1) & 1), float64((i >> 2) & 1)}
+}
+
+// Trilinear interpolation of the corner values, t in [0, 1]
+func trilinear(c *[8]float64, t vec.Vec3) float64 {
+	x00 := c[0] + (c[1]-c[0])*t[0]
+	x10 := c[2] + (c[3]-c[2])*t[0]
+	x01 := c[4] + (c[5]-c[4])*t[0]
+	x11 := c[6] + (c[7]-c[6])*t[0]
+	y0 := x00 + (x10-x00)*t[1]
+	y1 := x01 + (x11-x01)*t[1]
+
+	return y0 + (y1-y0)*t[2]
+}
+
+/*
+Builds the octree of a mesh. Cells are tested on the 3x3x3 lattice of their
+corners, face, edge and cell centers, and subdivided when the interpolated
+value at any of them is more than tolerance from the exact distance, down to
+maxDepth. The cells below the first levels are built by a pool of threads
+workers, GOMAXPROCS when zero. Returns the octree, and the number of cells at
+maxDepth that still don't meet the tolerance, or the error of ctx when it's
+done before finishing.
+*/
+func buildADF(ctx context.Context, mesh Mesh, rootMin vec.Vec3, rootSize float64, maxDepth int, tolerance float64, float32Kernel bool, threads int, progress Progress) (*ADF, int, error) {
+	// Triangle lists are only used to speed up the search, so they don't
+	// need the full resolution of the octree
+	listSize := vec.Min(1<<maxDepth, 64) + 1
+	rootMax := vec.Add(rootMin, vec.Vec3{rootSize, rootSize, rootSize})
+
+	logMessage(progress, "Creating triangle lists...")
+	triangleLists := mesh.createTriangleLists(listSize, listSize, listSize, rootMin, rootMax)
+	cellSize := listCellSize(listSize, listSize, listSize, rootMin, rootMax)
+	search := newTriangleSearch(mesh, float32Kernel)
+
+	// Cells up to this depth are split before the pool starts, the ones
+	// below are its tiles
+	const poolDepth = 2
+	tiles := 1 << (3 * poolDepth)
+
+	// Each worker keeps its own scratch set, and count of failed cells
+	workers := poolSize(threads, tiles)
+	visited := make([]*visitedSet, workers)
+	failed := make([]int, workers)
+	for i := range workers {
+		visited[i] = newVisitedSet(len(mesh.Triangles))
+	}
+
+	distance := func(worker int, p vec.Vec3) float64 {
+		var idx [3]int
+		for i := range 3 {
+			idx[i] = vec.Clamp(int(math.Round((p[i]-rootMin[i])/rootSize*float64(listSize-1))), 0, listSize-1)
+		}
+
+		return search.distanceUsingList(p, listSize, listSize, listSize, idx[0], idx[1], idx[2], triangleLists, cellSize, visited[worker])
+	}
+
+	// A cell still to be built
+	type adfTask struct {
+		cell    *adfCell
+		cellMin vec.Vec3
+		size    float64
+		depth   int
+	}
+
+	// Tests a cell, and gives it children when it has to be split
+	split := func(worker int, task adfTask) bool {
+		cell, cellMin, size := task.cell, task.cellMin, task.size
+
+		// Lattice of 3x3x3 values, corners are already known
+		var lattice [27]float64
+		maxError := 0.0
+
+		for z := range 3 {
+			for y := range 3 {
+				for x := range 3 {
+					i := x + y*3 + z*9
+					t := vec.Scale(vec.Vec3{float64(x), float64(y), float64(z)}, 0.5)
+
+					if x != 1 && y != 1 && z != 1 {
+						lattice[i] = cell.corners[x/2+(y/2)*2+(z/2)*4]
+						continue
+					}
+
+					lattice[i] = distance(worker, vec.Add(cellMin, vec.Scale(t, size)))
+					maxError = max(maxError, math.Abs(lattice[i]-trilinear(&cell.corners, t)))
+				}
+			}
+		}
+
+		if maxError <= tolerance {
+			return false
+		}
+
+		if task.depth == maxDepth {
+			failed[worker]++
+			return false
+		}
+
+		cell.children = &[8]adfCell{}
+
+		for i := range 8 {
+			o := adfOffset(i)
+			child := &cell.children[i]
+
+			for j := range 8 {
+				c := vec.Add(o, adfOffset(j))
+				child.corners[j] = lattice[int(c[0])+int(c[1])*3+int(c[2])*9]
+			}
+		}
+
+		return true
+	}
+
+	// Children of a split cell, as tasks
+	children := func(task adfTask) []adfTask {
+		var tasks []adfTask
+		for i := range 8 {
+			childMin := vec.Add(task.cellMin, vec.Scale(adfOffset(i), task.size*0.5))
+			tasks = append(tasks, adfTask{&task.cell.children[i], childMin, task.size * 0.5, task.depth + 1})
+		}
+		return tasks
+	}
+
+	var build func(worker int, task adfTask)
+	build = func(worker int, task adfTask) {
+		if ctx.Err() != nil || !split(worker, task) {
+			return
+		}
+
+		for _, child := range children(task) {
+			build(worker, child)
+		}
+	}
+
+	logMessage(progress, "Building octree...")
+
+	root := &adfCell{}
+	for i := range 8 {
+		root.corners[i] = distance(0, vec.Add(rootMin, vec.Scale(adfOffset(i), rootSize)))
+	}
+
+	// The first levels on this goroutine, they're only a few cells
+	level := []adfTask{{root, rootMin, rootSize, 0}}
+	for range poolDepth {
+		var next []adfTask
+		for _, task := range level {
+			if split(0, task) {
+				next = append(next, children(task)...)
+			}
+		}
+		level = next
+	}
+
+	runPool(ctx, threads, len(level), func(worker, tile int) {
+		build(worker, level[tile])
+	})
+
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total := 0
+	for _, f := range failed {
+		total += f
+	}
+
+	// Flatten breadth first, so siblings are consecutive
+	a := &ADF{rootMin: rootMin, rootSize: rootSize}
+	queue := []*adfCell{root}
+	a.nodes = append(a.nodes, 0)
+
+	for i := 0; i < len(queue); i++ {
+		cell := queue[i]
+
+		if cell.children == nil {
+			a.nodes[i] = adfLeaf | uint32(len(a.corners)/8)
+			for _, c := range cell.corners {
+				a.corners = append(a.corners, float32(c))
+			}
+			continue
+		}
+
+		a.nodes[i] = uint32(len(a.nodes))
+		for j := range 8 {
+			queue = append(queue, &cell.children[j])
+			a.nodes = append(a.nodes, 0)
+		}
+	}
+
+	return a, total, nil
+}
+
+// Sample samples the distance at p, points outside of the root cube are clamped to it
+func (a *ADF) Sample(p vec.Vec3) float64 {
+	// Position inside the current cell, in [0, 1]
+	var t vec.Vec3
+	for i := range 3 {
+		t[i] = vec.Saturate((p[i] - a.rootMin[i]) / a.rootSize)
+	}
+
+	node := a.nodes[0]
+	for node&adfLeaf == 0 {
+		child := 0
+		for i := range 3 {
+			t[i] *= 2.0
+			if t[i] >= 1.0 {
+				child |= 1 << i
+				t[i] -= 1.0
+			}
+		}
+
+		node = a.nodes[int(node)+child]
+	}
+
+	leaf := int(node&^adfLeaf) * 8
+	var corners [8]float64
+	for i := range 8 {
+		corners[i] = float64(a.corners[leaf+i])
+	}
+
+	return trilinear(&corners, t)
+}
+
+// Smallest and largest distance at the corners of the leaves
+func (a *ADF) distanceRange() (minD, maxD float64) {
+	minD = negSmallfloat64
+	maxD = posSmallfloat64
+
+	for _, d := range a.corners {
+		minD = min(minD, float64(d))
+		maxD = max(maxD, float64(d))
+	}
+
+	return minD, maxD
+}
+
+// Size of the serialized octree in bytes
+func (a *ADF) byteSize() int {
+	return 28 + len(a.nodes)*4 + len(a.corners)*4
+}
+
+// Write writes the octree in the binary format described on ADF
+func (a *ADF) Write(w io.Writer) error {
+	header := adfHeader{
+		Magic:     adfMagic,
+		NodeCount: uint32(len(a.nodes)),
+		LeafCount: uint32(len(a.corners) / 8),
+		RootMin:   [3]float32{float32(a.rootMin[0]), float32(a.rootMin[1]), float32(a.rootMin[2])},
+		RootSize:  float32(a.rootSize),
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, a.nodes); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, a.corners)
+}
+
+/*
+ReadADF reads an octree in the binary format described on ADF. The counts of
+the header are checked against the data that follows, and every node must
+point to a leaf or to children after it, so Sample can't go out of range or
+loop on a corrupt file.
+*/
+func ReadADF(r io.Reader) (*ADF, error) {
+	var header adfHeader
+
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if header.Magic != adfMagic {
+		return nil, fmt.Errorf("not an ADF file")
+	}
+
+	if header.NodeCount == 0 || !(header.RootSize > 0.0) || math.IsInf(float64(header.RootSize), 1) {
+		return nil, fmt.Errorf("invalid ADF header")
+	}
+
+	// Read what's there before allocating anything, so the counts of a
+	// corrupt header can't ask for more memory than the file has
+	size := int64(header.NodeCount)*4 + int64(header.LeafCount)*32
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) < size {
+		return nil, fmt.Errorf("ADF file is truncated, %d of %d bytes after the header", len(data), size)
+	}
+
+	a := &ADF{
+		rootMin:  vec.Vec3{float64(header.RootMin[0]), float64(header.RootMin[1]), float64(header.RootMin[2])},
+		rootSize: float64(header.RootSize),
+		nodes:    make([]uint32, header.NodeCount),
+		corners:  make([]float32, int(header.LeafCount)*8),
+	}
+
+	for i := range a.nodes {
+		a.nodes[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+
+	corners := data[len(a.nodes)*4:]
+	for i := range a.corners {
+		a.corners[i] = math.Float32frombits(binary.LittleEndian.Uint32(corners[i*4:]))
+	}
+
+	for i, node := range a.nodes {
+		if node&adfLeaf != 0 {
+			if node&^adfLeaf >= header.LeafCount {
+				return nil, fmt.Errorf("ADF node %d points to leaf %d of %d", i, node&^adfLeaf, header.LeafCount)
+			}
+			continue
+		}
+
+		if int(node) <= i || int(node)+8 > len(a.nodes) {
+			return nil, fmt.Errorf("ADF node %d has invalid children at %d", i, node)
+		}
+	}
+
+	return a, nil
+}
@@ -0,0 +1,149 @@
+package sdf
+
+import (
+	"context"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+const (
+	aoSamples  = 6   // Samples along the gradient
+	aoDistance = 8.0 // Distance of the last sample, in texels
+)
+
+// Trilinear sample at texel coordinates, coordinates outside of the grid are clamped
+func (f *DistanceField) sampleTexel(u vec.Vec3) float64 {
+	x := vec.Clamp(u[0], 0.0, float64(f.Width-1))
+	y := vec.Clamp(u[1], 0.0, float64(f.Height-1))
+	z := vec.Clamp(u[2], 0.0, float64(f.Depth-1))
+
+	x0, y0, z0 := math.Floor(x), math.Floor(y), math.Floor(z)
+	ix, iy, iz := int(x0), int(y0), int(z0)
+
+	var corners [8]float64
+	for i := range 8 {
+		corners[i] = f.at(ix+i&1, iy+(i>>1)&1, iz+(i>>2)&1)
+	}
+
+	return trilinear(&corners, vec.Vec3{x - x0, y - y0, z - z0})
+}
+
+/*
+Ambient occlusion from samples along the gradient, in [0, 1] where 1 is not
+occluded. Each sample is compared with the distance it would have if there was
+nothing else around, the closer surfaces get to the cone the darker it gets.
+texel is the size of a texel in distance units.
+*/
+func (f *DistanceField) ambientOcclusion(x, y, z int, texel float64) float64 {
+	g := f.gradient(x, y, z)
+	if vec.Dot2(g) == 0.0 {
+		return 1.0
+	}
+
+	n := vec.Normalize(g)
+	p := vec.Vec3{float64(x), float64(y), float64(z)}
+	d := f.at(x, y, z) / texel
+
+	occlusion := 0.0
+	weight := 1.0
+	weights := 0.0
+
+	for i := 1; i <= aoSamples; i++ {
+		h := aoDistance * float64(i) / aoSamples
+		s := f.sampleTexel(vec.Add(p, vec.Scale(n, h))) / texel
+
+		occlusion += weight * vec.Saturate((d+h-s)/h)
+		weights += weight
+		weight *= 0.75
+	}
+
+	return 1.0 - occlusion/weights
+}
+
+/*
+Distance from the surface point closest to the texel to the opposite side,
+going inwards along the gradient, in texels. Sphere traces the inside of the
+field until it's out of the mesh, or out of the grid.
+texel is the size of a texel in distance units.
+*/
+func (f *DistanceField) thickness(x, y, z int, texel float64) float64 {
+	g := f.gradient(x, y, z)
+	if vec.Dot2(g) == 0.0 {
+		return 0.0
+	}
+
+	n := vec.Normalize(g)
+	p := vec.Vec3{float64(x), float64(y), float64(z)}
+
+	// Start on the surface
+	surface := vec.Sub(p, vec.Scale(n, f.at(x, y, z)/texel))
+	maxLength := vec.Length(vec.Vec3{float64(f.Width), float64(f.Height), float64(f.Depth)})
+
+	t := 0.0
+	for t < maxLength {
+		q := vec.Sub(surface, vec.Scale(n, t))
+		if q[0] < 0.0 || q[1] < 0.0 || q[2] < 0.0 || q[0] > float64(f.Width-1) || q[1] > float64(f.Height-1) || q[2] > float64(f.Depth-1) {
+			break
+		}
+
+		d := f.sampleTexel(q) / texel
+		if d >= 0.0 && t > 0.0 {
+			break
+		}
+
+		t += max(math.Abs(d), 0.25)
+	}
+
+	return t
+}
+
+/*
+Bakes ambient occlusion and thickness for the texels within band texels of the
+surface, texels further away are not occluded and have no thickness. Returns
+both, and the biggest thickness in texels. Slices are baked by a pool of
+threads workers, GOMAXPROCS when zero.
+*/
+func (f *DistanceField) occlusionAndThickness(texel, band float64, threads int) (occlusion, thickness []float64, maxThickness float64) {
+	occlusion = make([]float64, len(f.Data))
+	thickness = make([]float64, len(f.Data))
+
+	// One tile per slice, and the biggest thickness of each worker
+	workerMax := make([]float64, poolSize(threads, f.Depth))
+
+	runPool(context.Background(), threads, f.Depth, func(worker, z int) {
+		for y := range f.Height {
+			for x := range f.Width {
+				i := x + y*f.Width + z*f.Width*f.Height
+				occlusion[i] = 1.0
+
+				if math.Abs(f.Data[i])/texel > band {
+					continue
+				}
+
+				occlusion[i] = f.ambientOcclusion(x, y, z, texel)
+				thickness[i] = f.thickness(x, y, z, texel)
+				workerMax[worker] = max(workerMax[worker], thickness[i])
+			}
+		}
+	})
+
+	for _, t := range workerMax {
+		maxThickness = max(maxThickness, t)
+	}
+
+	return occlusion, thickness, maxThickness
+}
+
+// Packs two values in [0, 1] in RG, as 8 or 16 bits per channel
+func packRG(r, g []float64, bits int) []byte {
+	size := bits / 8
+	out := make([]byte, len(r)*2*size)
+
+	for i := range r {
+		putUnorm(out[i*2*size:], r[i], bits)
+		putUnorm(out[i*2*size+size:], g[i], bits)
+	}
+
+	return out
+}
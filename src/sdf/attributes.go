@@ -0,0 +1,104 @@
+package sdf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+/*
+Closest point on the mesh of each texel, and its barycentric coordinates on the
+closest triangle. Needs the closest triangle of each texel.
+*/
+func closestPoints(mesh Mesh, field DistanceField) (points, barycentrics []vec.Vec3) {
+	points = make([]vec.Vec3, len(field.Data))
+	barycentrics = make([]vec.Vec3, len(field.Data))
+
+	for z := range field.Depth {
+		for y := range field.Height {
+			for x := range field.Width {
+				i := x + y*field.Width + z*field.Width*field.Height
+				triangle := mesh.Triangles[field.Triangles[i]]
+
+				points[i], barycentrics[i] = closestPoint(
+					field.position(x, y, z),
+					mesh.Vertices[triangle[0]],
+					mesh.Vertices[triangle[1]],
+					mesh.Vertices[triangle[2]])
+			}
+		}
+	}
+
+	return points, barycentrics
+}
+
+// Closest triangle index of each texel, as little endian u32
+func packTriangleIDs(triangles []int) []byte {
+	out := make([]byte, len(triangles)*4)
+
+	for i, triangle := range triangles {
+		binary.LittleEndian.PutUint32(out[i*4:], uint32(triangle))
+	}
+
+	return out
+}
+
+// Barycentric coordinates of each texel, as 3 little endian f32
+func packBarycentrics(barycentrics []vec.Vec3) []byte {
+	out := make([]byte, len(barycentrics)*12)
+
+	for i, b := range barycentrics {
+		for c := range 3 {
+			binary.LittleEndian.PutUint32(out[i*12+c*4:], math.Float32bits(float32(b[c])))
+		}
+	}
+
+	return out
+}
+
+// Material index of the closest triangle of each texel, u8 when there are up to 256 materials, little endian u16 otherwise
+func packMaterials(mesh Mesh, triangles []int) (data []byte, bits int) {
+	if len(mesh.Materials) <= 256 {
+		data = make([]byte, len(triangles))
+		for i, triangle := range triangles {
+			data[i] = byte(mesh.TriangleMaterials[triangle])
+		}
+
+		return data, 8
+	}
+
+	data = make([]byte, len(triangles)*2)
+	for i, triangle := range triangles {
+		binary.LittleEndian.PutUint16(data[i*2:], mesh.TriangleMaterials[triangle])
+	}
+
+	return data, 16
+}
+
+// Vertex colors interpolated at the closest point of each texel, as RGBA8. Needs the closest triangle of each texel.
+func vertexColors(mesh Mesh, field DistanceField) ([]byte, error) {
+	if mesh.Colors == nil {
+		return nil, fmt.Errorf("the mesh has no vertex colors")
+	}
+
+	_, barycentrics := closestPoints(mesh, field)
+	out := make([]byte, len(field.Data)*4)
+
+	for i, triangleIdx := range field.Triangles {
+		triangle := mesh.Triangles[triangleIdx]
+
+		var color vec.Vec3
+		for j := range 3 {
+			color = vec.Add(color, vec.Scale(mesh.Colors[triangle[j]], barycentrics[i][j]))
+		}
+
+		for c := range 3 {
+			putUnorm(out[i*4+c:], color[c], 8)
+		}
+		out[i*4+3] = 255
+	}
+
+	return out, nil
+}
@@ -0,0 +1,342 @@
+package sdf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// mirror modes
+type convertionOptions uint16
+
+const resLimit = 4096
+const sizeLimit = 16 * 1024 * 1024 // 16MB
+
+const (
+	convertionOptionsMirrorX              = 1 << 0
+	convertionOptionsMirrorXIncludeCenter = 1 << 1
+	convertionOptionsMirrorXNegative      = 1 << 2
+	convertionOptionsMirrorY              = 1 << 3
+	convertionOptionsMirrorYIncludeCenter = 1 << 4
+	convertionOptionsMirrorYNegative      = 1 << 5
+	convertionOptionsMirrorZ              = 1 << 6
+	convertionOptionsMirrorZIncludeCenter = 1 << 7
+	convertionOptionsMirrorZNegative      = 1 << 8
+
+	convertionOptions16bits     = 1 << 9  // 16 bits output, 8 bits otherwise
+	convertionOptionsTexelUnits = 1 << 10 // distances in texels, world units otherwise
+	convertionOptionsTriangles  = 1 << 11 // keep the closest triangle of each texel
+	convertionOptionsFloat32    = 1 << 12 // float32 distance kernel, float64 otherwise
+	convertionOptionsHybrid     = 1 << 13 // exact distances near the surface only, swept elsewhere
+	convertionOptionsFloodFill  = 1 << 14 // signs from a flood fill of the exterior, triangle normals otherwise
+	convertionOptionsAverage    = 1 << 15 // average of the sub-samples, the closest to the surface otherwise
+)
+
+type distanceSettings struct {
+	width             uint16
+	height            uint16
+	depth             uint16
+	convertionOptions convertionOptions
+	threads           int // Workers, GOMAXPROCS when zero
+	supersample       int // Sub-samples per texel along each axis, one or less for none
+	sampling          Sampling
+}
+
+// Volume is a 3D texture, with the texels of every mip level one after the other
+type Volume struct {
+	Name                 string // Suffix of the file name, empty for the distance texture
+	Width, Height, Depth int
+	Mips                 int
+	DXGIFormat           uint32 // Format of the DX10 DDS header, 0 for the legacy header
+	Bits                 int    // Bits per texel of the legacy DDS header
+	Ext                  string // Extension of volumes that are always written as is, empty for textures
+	Data                 []byte
+}
+
+// Extension returns the file extension of the volume written in format
+func (v *Volume) Extension(format Format) string {
+	if v.Ext != "" {
+		return v.Ext
+	}
+
+	return string(format)
+}
+
+// Write writes the volume in format, as a DDS or KTX2 file or raw texels
+func (v *Volume) Write(w io.Writer, format Format) error {
+	switch {
+	case format == FormatBin || v.Ext != "":
+		_, err := w.Write(v.Data)
+		return err
+	case format == FormatKTX2:
+		return Write3DTextureAsKTX2(w, v.Data, uint32(v.Width), uint32(v.Height), uint32(v.Depth), v.vkFormat(), uint32(v.Mips))
+	case v.DXGIFormat != 0:
+		return Write3DTextureAsDDSDX10(w, v.Data, uint32(v.Width), uint32(v.Height), uint32(v.Depth), v.DXGIFormat, uint32(v.Mips))
+	default:
+		return Write3DTextureAsDDS(w, v.Data, uint32(v.Width), uint32(v.Height), uint32(v.Depth), uint32(v.Bits), uint32(v.Mips))
+	}
+}
+
+// Result of a bake
+type Result struct {
+	Mesh *Mesh
+
+	// Float distances, only the size and bounds of the grid for bricks and octrees
+	Field DistanceField
+
+	// Range used for quantization
+	MinD, MaxD float64
+
+	// Distance texture, and the volumes that go with it
+	Texture Volume
+	Volumes []Volume
+
+	// Description of the textures, the json file of the command line tool.
+	// The paths of the files, "texture_data" and "<volume name>_data", are
+	// up to the caller.
+	Metadata map[string]any
+
+	options   Options
+	bricks    *brickVolume // Sparse bricks instead of the full field, when not nil
+	adf       *ADF         // Adaptive octree instead of the full field, when not nil
+	adfFailed int          // Octree cells that don't meet the tolerance
+	channels  []Range      // Ranges of the meshes packed into the channels of the texture
+	hybrid    *hybridError // Hybrid field compared to the exact one, when asked for
+}
+
+// Difference between a hybrid field and the exact one
+type hybridError struct {
+	max, mean     float64
+	signDifferent int
+}
+
+// Bake calculates the distance field of a mesh, and encodes it with the range
+// from the options, or the range of the distances.
+func Bake(ctx context.Context, mesh *Mesh, options Options) (*Result, error) {
+	r, err := Calculate(ctx, mesh, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Encode(ctx, r.MinD, r.MaxD); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+/*
+Calculate calculates the distance field of a mesh, without encoding it. MinD
+and MaxD of the result are the range from the options, or the range of the
+distances, Encode can use a different one, so several meshes share it.
+*/
+func Calculate(ctx context.Context, mesh *Mesh, options Options) (*Result, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	boundsMin, boundsMax := mesh.Min, mesh.Max
+	if options.hasBounds() {
+		boundsMin, boundsMax = options.BoundsMin, options.BoundsMax
+	}
+
+	w, h, d, gridMin, gridMax := calculateGridSize(boundsMin, boundsMax, options.Resolution, options.Sampling)
+	logMessage(options.Progress, "Output resolution: %d x %d x %d", w, h, d)
+
+	settings := options.settings(w, h, d)
+	t := texelSize(w, gridMin, gridMax, options.Sampling)
+
+	r := &Result{
+		Mesh: mesh,
+		Field: DistanceField{
+			Width:    w,
+			Height:   h,
+			Depth:    d,
+			GridMin:  gridMin,
+			GridMax:  gridMax,
+			Sampling: options.Sampling,
+		},
+		options: options,
+	}
+
+	switch {
+	case options.ADF:
+		side := vec.Max3(gridMax[0]-gridMin[0], gridMax[1]-gridMin[1], gridMax[2]-gridMin[2])
+		rootMin := vec.Sub(vec.Scale(vec.Add(gridMin, gridMax), 0.5), vec.Scale(vec.Vec3{side, side, side}, 0.5))
+		maxDepth := int(math.Ceil(math.Log2(float64(options.Resolution))))
+
+		var err error
+		r.adf, r.adfFailed, err = buildADF(ctx, *mesh, rootMin, side, maxDepth, options.Tolerance*t, options.Float32, options.Threads, options.Progress)
+		if err != nil {
+			return nil, err
+		}
+
+		logMessage(options.Progress, "Octree: %d nodes, %d leaves, %d bytes, uniform %d x %d x %d float grid: %d bytes",
+			len(r.adf.nodes), len(r.adf.corners)/8, r.adf.byteSize(), w, h, d, w*h*d*4)
+
+		if r.adfFailed > 0 {
+			logWarning(options.Progress, -1, "%d cells at the maximum depth are off by more than the tolerance", r.adfFailed)
+		}
+
+		// Only the range of the samples, the octree keeps the distances as floats
+		r.Field.MinD, r.Field.MaxD = r.adf.distanceRange()
+
+	case options.BrickSize > 0:
+		bricks, err := calculateBricks(ctx, settings, *mesh, gridMin, gridMax, options.BrickSize, options.Band*t, options.Progress)
+		if err != nil {
+			return nil, err
+		}
+
+		logMessage(options.Progress, "%d of %d bricks stored", len(bricks.bricks), len(bricks.indirection))
+
+		ax, ay, az := bricks.atlasSize()
+		stored := bricks.storedSize()
+		if ax*ay*az*stored*stored*stored > sizeLimit {
+			return nil, fmt.Errorf("brick atlas is too big (%d), maximum allowed is %d texels", ax*ay*az*stored*stored*stored, sizeLimit)
+		}
+
+		r.bricks = &bricks
+		r.Field.MinD, r.Field.MaxD = bricks.minD, bricks.maxD
+
+	default:
+		if (w * h * d) > sizeLimit {
+			return nil, fmt.Errorf("output size is too big (%d), maximum allowed is %d bytes", w*h*d, sizeLimit)
+		}
+
+		field, err := calculate(ctx, settings, *mesh, gridMin, gridMax, options.Progress)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Field = field
+
+		if options.Hybrid {
+			logMessage(options.Progress, "%d of %d texels are exact, the rest were swept", field.exactTexels, w*h*d)
+		}
+
+		if options.Sign == SignFloodFill {
+			logMessage(options.Progress, "%d texels have the opposite sign from the triangle normals", field.signDifferences)
+		}
+
+		if options.HybridReport {
+			settings.convertionOptions &^= convertionOptionsHybrid
+			exact, err := calculate(ctx, settings, *mesh, gridMin, gridMax, options.Progress)
+			if err != nil {
+				return nil, err
+			}
+
+			r.hybrid = compareFields(field, exact)
+			logMessage(options.Progress, "Hybrid field error: max %f, mean %f %s units, %d texels with a different sign",
+				r.hybrid.max, r.hybrid.mean, options.Units, r.hybrid.signDifferent)
+		}
+	}
+
+	fixed := options.Range.Min < options.Range.Max
+	texelUnits := options.Units == UnitsTexel
+
+	switch {
+	case fixed && options.RangeTexels && !texelUnits:
+		r.MinD, r.MaxD = options.Range.Min*t, options.Range.Max*t
+	case fixed && !options.RangeTexels && texelUnits:
+		r.MinD, r.MaxD = options.Range.Min/t, options.Range.Max/t
+	case fixed:
+		r.MinD, r.MaxD = options.Range.Min, options.Range.Max
+	default:
+		r.MinD, r.MaxD = r.Field.MinD, r.Field.MaxD
+	}
+
+	return r, nil
+}
+
+// Compares a field to the exact one
+func compareFields(field, exact DistanceField) *hybridError {
+	e := &hybridError{}
+
+	for i, d := range field.Data {
+		diff := math.Abs(d - exact.Data[i])
+		e.max = max(e.max, diff)
+		e.mean += diff
+
+		if (d < 0.0) != (exact.Data[i] < 0.0) {
+			e.signDifferent++
+		}
+	}
+
+	e.mean /= float64(len(field.Data))
+
+	return e
+}
+
+// SharedRange returns the smallest range that includes the distances of all the results
+func SharedRange(results []*Result) (minD, maxD float64) {
+	minD = negSmallfloat64
+	maxD = posSmallfloat64
+
+	for _, r := range results {
+		minD = min(minD, r.Field.MinD)
+		maxD = max(maxD, r.Field.MaxD)
+	}
+
+	return minD, maxD
+}
+
+// Encode quantizes or compresses the distances with the range minD, maxD,
+// and calculates the volumes that go with them.
+func (r *Result) Encode(ctx context.Context, minD, maxD float64) error {
+	r.MinD, r.MaxD = minD, maxD
+	r.Volumes = nil
+
+	var err error
+
+	switch {
+	case r.adf != nil:
+		err = r.encodeADF()
+	case r.bricks != nil:
+		err = r.encodeBricks()
+	default:
+		err = r.encodeGrid(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
+
+// Snippet returns the shader call with the constants that decode the
+// distance texture, or an empty string when there's none. It builds a model
+// of unpack.glsl, or a modelChannels for packed channels.
+func (r *Result) Snippet() string {
+	// Atlases have no single grid
+	if r.adf != nil || r.bricks != nil || r.Mesh == nil {
+		return ""
+	}
+
+	if r.channels != nil {
+		// Unused channels decode to zero
+		var minD, maxD [4]float64
+		for i, c := range r.channels {
+			minD[i], maxD[i] = c.Min, c.Max
+		}
+
+		return fmt.Sprintf("modelChannels(vec3(%f, %f, %f),\n\tvec3(%f, %f, %f),\n\tvec4(%f, %f, %f, %f),\n\tvec4(%f, %f, %f, %f));\n",
+			r.Field.GridMin[0], r.Field.GridMin[1], r.Field.GridMin[2],
+			r.Field.GridMax[0], r.Field.GridMax[1], r.Field.GridMax[2],
+			minD[0], minD[1], minD[2], minD[3],
+			maxD[0], maxD[1], maxD[2], maxD[3])
+	}
+
+	return fmt.Sprintf("model(vec3(%f, %f, %f),\n\tvec3(%f, %f, %f),\n\t%f,\n\t%f);\n",
+		r.Field.GridMin[0], r.Field.GridMin[1], r.Field.GridMin[2],
+		r.Field.GridMax[0], r.Field.GridMax[1], r.Field.GridMax[2],
+		r.MinD,
+		r.MaxD)
+}
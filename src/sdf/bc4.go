@@ -0,0 +1,302 @@
+package sdf
+
+import (
+	"context"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Value limits for BC4 unsigned and signed blocks
+const (
+	bc4UnormMin = 0
+	bc4UnormMax = 255
+	bc4SnormMin = -127
+	bc4SnormMax = 127
+)
+
+/*
+Converts the distances to signed 8 bits values in [-127, 127], for BC4 signed
+blocks, the range is [-r, r] so a zero distance is stored as zero.
+Values outside the range are clamped, and the number of clamped values is returned.
+*/
+func quantizeSigned(data []float64, r float64) (values []int, clamped int) {
+	values = make([]int, len(data))
+
+	for i, v := range data {
+		if v < -r || v > r {
+			clamped++
+		}
+
+		// Rounding up or down depending on the sign of the distance value
+		v = v / r * 127.0
+		if v < 0.0 {
+			values[i] = int(vec.Clamp(math.Floor(v), -127.0, 127.0))
+		} else {
+			values[i] = int(vec.Clamp(math.Ceil(v), -127.0, 127.0))
+		}
+	}
+
+	return values, clamped
+}
+
+// Palette of a block, the order matches the 3 bit indices
+func bc4Palette(e0, e1, lo, hi int) [8]float64 {
+	var p [8]float64
+	p[0] = float64(e0)
+	p[1] = float64(e1)
+
+	if e0 > e1 {
+		for i := 2; i < 8; i++ {
+			p[i] = float64((8-i)*e0+(i-1)*e1) / 7.0
+		}
+	} else {
+		for i := 2; i < 6; i++ {
+			p[i] = float64((6-i)*e0+(i-1)*e1) / 5.0
+		}
+		p[6] = float64(lo)
+		p[7] = float64(hi)
+	}
+
+	return p
+}
+
+// Picks the closest palette entry for each value, and returns the biggest error
+func bc4Indices(values *[16]int, palette *[8]float64) (indices [16]uint8, maxError float64) {
+	for i, v := range values {
+		best := math.Inf(1)
+
+		for j, p := range palette {
+			if e := math.Abs(float64(v) - p); e < best {
+				best = e
+				indices[i] = uint8(j)
+			}
+		}
+
+		maxError = max(maxError, best)
+	}
+
+	return indices, maxError
+}
+
+/*
+Compresses a 4x4 block. Instead of minimizing the RMS error, the endpoints are
+picked to minimize the maximum error, because a distance that's off by a lot in
+a single texel is worse than small errors everywhere.
+
+For evenly spaced palettes the maximum error is minimized by moving the
+endpoints inwards by half a step, so we search around that point, for both
+block modes.
+*/
+func encodeBC4Block(values *[16]int, lo, hi int) (block [8]byte, maxError float64) {
+	maxError = math.Inf(1)
+
+	try := func(e0, e1 int) {
+		e0 = vec.Clamp(e0, lo, hi)
+		e1 = vec.Clamp(e1, lo, hi)
+		palette := bc4Palette(e0, e1, lo, hi)
+		indices, e := bc4Indices(values, &palette)
+
+		if e >= maxError {
+			return
+		}
+
+		// Signed endpoints are stored in two's complement
+		maxError = e
+		block[0] = byte(e0)
+		block[1] = byte(e1)
+
+		var bits uint64
+		for i, index := range indices {
+			bits |= uint64(index) << (3 * i)
+		}
+
+		for i := range 6 {
+			block[2+i] = byte(bits >> (8 * i))
+		}
+	}
+
+	// 8 interpolated values
+	vMin, vMax := hi, lo
+	for _, v := range values {
+		vMin = min(vMin, v)
+		vMax = max(vMax, v)
+	}
+
+	if vMin == vMax {
+		// e0 > e1 is required for the 8 values mode, but a flat block
+		// is exactly represented by either endpoint
+		if vMax < hi {
+			try(vMax+1, vMin)
+		} else {
+			try(vMax, vMin-1)
+		}
+		return block, maxError
+	}
+
+	inset := int(math.Round(float64(vMax-vMin) / 16.0))
+	for d0 := -2; d0 <= 2; d0++ {
+		for d1 := -2; d1 <= 2; d1++ {
+			e0 := vMax - inset + d0
+			e1 := vMin + inset + d1
+			if e0 > e1 {
+				try(e0, e1)
+			}
+		}
+	}
+	try(vMax, vMin)
+
+	// 6 interpolated values plus the limits, useful when part of the block
+	// was clamped to the limits
+	vMin, vMax = hi, lo
+	for _, v := range values {
+		if v != lo && v != hi {
+			vMin = min(vMin, v)
+			vMax = max(vMax, v)
+		}
+	}
+
+	if vMin <= vMax {
+		inset = int(math.Round(float64(vMax-vMin) / 12.0))
+		for d0 := -2; d0 <= 2; d0++ {
+			for d1 := -2; d1 <= 2; d1++ {
+				e0 := vMin + inset + d0
+				e1 := vMax - inset + d1
+				if e0 <= e1 {
+					try(e0, e1)
+				}
+			}
+		}
+		try(vMin, vMax)
+	}
+
+	return block, maxError
+}
+
+/*
+Compresses each Z slice of a volume into BC4 4x4 blocks, values are in [0, 255],
+or in [-127, 127] for signed blocks. Blocks that go past the edges repeat the
+last texel. Returns the blocks and the biggest error of any texel. Slices are
+compressed by a pool of threads workers, GOMAXPROCS when zero.
+*/
+func encodeBC4(values []int, width, height, depth int, signed bool, threads int) (blocks []byte, maxError float64) {
+	lo, hi := bc4UnormMin, bc4UnormMax
+	if signed {
+		lo, hi = bc4SnormMin, bc4SnormMax
+	}
+
+	blocksX := (width + 3) / 4
+	blocksY := (height + 3) / 4
+	sliceSize := blocksX * blocksY * 8
+	blocks = make([]byte, sliceSize*depth)
+
+	// One tile per slice, and the biggest error of each worker
+	workerError := make([]float64, poolSize(threads, depth))
+
+	runPool(context.Background(), threads, depth, func(worker, z int) {
+		for by := range blocksY {
+			for bx := range blocksX {
+				var block [16]int
+				for i := range 16 {
+					x := vec.Min(bx*4+i%4, width-1)
+					y := vec.Min(by*4+i/4, height-1)
+					block[i] = values[x+y*width+z*width*height]
+				}
+
+				encoded, e := encodeBC4Block(&block, lo, hi)
+				copy(blocks[z*sliceSize+(bx+by*blocksX)*8:], encoded[:])
+				workerError[worker] = max(workerError[worker], e)
+			}
+		}
+	})
+
+	for _, e := range workerError {
+		maxError = max(maxError, e)
+	}
+
+	return blocks, maxError
+}
+
+// Decompresses a volume of BC4 blocks back to values in [0, 255] or [-127, 127]
+func decodeBC4(blocks []byte, width, height, depth int, signed bool) []float64 {
+	lo, hi := bc4UnormMin, bc4UnormMax
+	if signed {
+		lo, hi = bc4SnormMin, bc4SnormMax
+	}
+
+	blocksX := (width + 3) / 4
+	blocksY := (height + 3) / 4
+	values := make([]float64, width*height*depth)
+
+	for z := range depth {
+		for by := range blocksY {
+			for bx := range blocksX {
+				block := blocks[(z*blocksX*blocksY+bx+by*blocksX)*8:]
+
+				e0, e1 := int(block[0]), int(block[1])
+				if signed {
+					e0 = vec.Max(int(int8(block[0])), bc4SnormMin)
+					e1 = vec.Max(int(int8(block[1])), bc4SnormMin)
+				}
+				palette := bc4Palette(e0, e1, lo, hi)
+
+				var bits uint64
+				for i := range 6 {
+					bits |= uint64(block[2+i]) << (8 * i)
+				}
+
+				for i := range 16 {
+					x := bx*4 + i%4
+					y := by*4 + i/4
+					if x < width && y < height {
+						values[x+y*width+z*width*height] = palette[(bits>>(3*i))&7]
+					}
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+/*
+Quantizes and compresses a level, returns the blocks, the biggest difference
+between the decompressed and the original distances (ignoring values outside
+the range), and the number of clamped values.
+With signed blocks the range must be symmetric, [-maxD, maxD].
+*/
+func compressBC4(level mipLevel, minD, maxD float64, signed bool, threads int) (blocks []byte, maxError float64, clamped int) {
+	var values []int
+
+	if signed {
+		values, clamped = quantizeSigned(level.data, maxD)
+	} else {
+		var data []byte
+		data, clamped = quantize(distanceSettings{}, level.data, minD, maxD, nil)
+
+		values = make([]int, len(data))
+		for i, v := range data {
+			values[i] = int(v)
+		}
+	}
+
+	blocks, _ = encodeBC4(values, level.width, level.height, level.depth, signed, threads)
+	decoded := decodeBC4(blocks, level.width, level.height, level.depth, signed)
+
+	for i, v := range decoded {
+		d := level.data[i]
+		if d < minD || d > maxD {
+			continue
+		}
+
+		if signed {
+			v = v / 127.0 * maxD
+		} else {
+			v = v/255.0*(maxD-minD) + minD
+		}
+
+		maxError = max(maxError, math.Abs(v-d))
+	}
+
+	return blocks, maxError, clamped
+}
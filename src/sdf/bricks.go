@@ -0,0 +1,223 @@
+package sdf
+
+import (
+	"context"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Indirection value of bricks that are too far from the surface to be stored
+const brickEmpty = -1
+
+/*
+Sparse distance field, the grid is split in bricks of brickSize^3 texels and
+only the bricks close to the surface are kept. Each stored brick has a one texel
+apron on every side, so it can be filtered without looking at its neighbours.
+*/
+type brickVolume struct {
+	brickSize                 int // Texels per side, without the apron
+	bricksX, bricksY, bricksZ int // Size of the indirection volume
+	indirection               []int
+	bricks                    [][]float64 // (brickSize+2)^3 distances each
+	minD, maxD                float64
+}
+
+// Texels per side of a stored brick, including the apron
+func (b *brickVolume) storedSize() int {
+	return b.brickSize + 2
+}
+
+/*
+Calculates the distance only for the bricks within band of the surface.
+Triangle lists are created with one cell per brick, and bricks whose center is
+too far from the surface to have any texel in the band are skipped without
+calculating the rest, so the full resolution grid is never evaluated.
+*/
+func calculateBricks(ctx context.Context, settings distanceSettings, mesh Mesh, gridMin, gridMax vec.Vec3, brickSize int, band float64, progress Progress) (brickVolume, error) {
+	width := int(settings.width)
+	height := int(settings.height)
+	depth := int(settings.depth)
+
+	volume := brickVolume{
+		brickSize: brickSize,
+		bricksX:   (width + brickSize - 1) / brickSize,
+		bricksY:   (height + brickSize - 1) / brickSize,
+		bricksZ:   (depth + brickSize - 1) / brickSize,
+		minD:      negSmallfloat64,
+		maxD:      posSmallfloat64,
+	}
+	volume.indirection = make([]int, volume.bricksX*volume.bricksY*volume.bricksZ)
+
+	pointScale, pointBias := gridScaleBias(width, height, depth, gridMin, gridMax, settings.sampling)
+
+	// Brick corners, one list cell per brick
+	listWidth := volume.bricksX + 1
+	listHeight := volume.bricksY + 1
+	listDepth := volume.bricksZ + 1
+	listMax := vec.Add(vec.Mul(vec.Scale(vec.Vec3{float64(listWidth - 1), float64(listHeight - 1), float64(listDepth - 1)}, float64(brickSize)), pointScale), pointBias)
+
+	logMessage(progress, "Creating triangle lists...")
+	triangleLists := mesh.createTriangleLists(listWidth, listHeight, listDepth, pointBias, listMax)
+	cellSize := listCellSize(listWidth, listHeight, listDepth, pointBias, listMax)
+	search := newTriangleSearch(mesh, settings.convertionOptions&convertionOptionsFloat32 == convertionOptionsFloat32)
+
+	texelDistance := func(x, y, z float64, visited *visitedSet) float64 {
+		p := vec.Add(vec.Mul(vec.Vec3{x, y, z}, pointScale), pointBias)
+		ix := vec.Clamp(int(math.Round(x/float64(brickSize))), 0, listWidth-1)
+		iy := vec.Clamp(int(math.Round(y/float64(brickSize))), 0, listHeight-1)
+		iz := vec.Clamp(int(math.Round(z/float64(brickSize))), 0, listDepth-1)
+
+		return search.distanceUsingList(p, listWidth, listHeight, listDepth, ix, iy, iz, triangleLists, cellSize, visited)
+	}
+
+	// Distance from the center of a brick to the corners of its apron
+	stored := brickSize + 2
+	halfDiagonal := math.Sqrt(3.0) * float64(brickSize+1) * 0.5 * vec.Max3(pointScale[0], pointScale[1], pointScale[2])
+
+	rowCount := volume.bricksY * volume.bricksZ
+	rows := make([][][]float64, rowCount)
+
+	visited := make([]*visitedSet, poolSize(settings.threads, rowCount))
+	for i := range visited {
+		visited[i] = newVisitedSet(len(mesh.Triangles))
+	}
+
+	// One tile, and one step, per row of bricks
+	stage := startStage(progress, "Calculating bricks", rowCount)
+
+	runPool(ctx, settings.threads, rowCount, func(worker, row int) {
+		by := row % volume.bricksY
+		bz := row / volume.bricksY
+
+		for bx := range volume.bricksX {
+			i := bx + by*volume.bricksX + bz*volume.bricksX*volume.bricksY
+			volume.indirection[i] = brickEmpty
+
+			c := float64(brickSize-1) * 0.5
+			dc := texelDistance(float64(bx*brickSize)+c, float64(by*brickSize)+c, float64(bz*brickSize)+c, visited[worker])
+			if math.Abs(dc)-halfDiagonal > band {
+				continue
+			}
+
+			brick := make([]float64, stored*stored*stored)
+			closest := posBigfloat64
+
+			for z := range stored {
+				for y := range stored {
+					for x := range stored {
+						d := texelDistance(float64(bx*brickSize+x-1), float64(by*brickSize+y-1), float64(bz*brickSize+z-1), visited[worker])
+						brick[x+y*stored+z*stored*stored] = d
+						closest = min(closest, math.Abs(d))
+					}
+				}
+			}
+
+			if closest <= band {
+				// Index in the row for now, the final index is set once all rows are done
+				volume.indirection[i] = len(rows[row])
+				rows[row] = append(rows[row], brick)
+			}
+		}
+
+		stage.add(1)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return brickVolume{}, err
+	}
+
+	offsets := make([]int, rowCount)
+	for row, bricks := range rows {
+		offsets[row] = len(volume.bricks)
+		volume.bricks = append(volume.bricks, bricks...)
+	}
+
+	for i, index := range volume.indirection {
+		if index != brickEmpty {
+			volume.indirection[i] = index + offsets[i/volume.bricksX]
+		}
+	}
+
+	// Measure distances in texels of the output grid instead of world units
+	scale := 1.0
+	if settings.convertionOptions&convertionOptionsTexelUnits == convertionOptionsTexelUnits {
+		scale = 1.0 / texelSize(width, gridMin, gridMax, settings.sampling)
+	}
+
+	for _, brick := range volume.bricks {
+		for i := range brick {
+			brick[i] *= scale
+			volume.minD = min(volume.minD, brick[i])
+			volume.maxD = max(volume.maxD, brick[i])
+		}
+	}
+
+	return volume, nil
+}
+
+// Size of the atlas in bricks, close to a cube
+func (b *brickVolume) atlasSize() (x, y, z int) {
+	n := len(b.bricks)
+	x = vec.Max(1, int(math.Ceil(math.Cbrt(float64(n)))))
+	y = vec.Max(1, int(math.Ceil(math.Sqrt(float64(n)/float64(x)))))
+	z = vec.Max(1, (n+x*y-1)/(x*y))
+
+	return x, y, z
+}
+
+// Position of a brick in the atlas, in bricks
+func (b *brickVolume) atlasPosition(index int) (x, y, z int) {
+	ax, ay, _ := b.atlasSize()
+	return index % ax, (index / ax) % ay, index / (ax * ay)
+}
+
+/*
+Packs the bricks in an atlas, texels that don't belong to any brick are set to
+empty. Returns the atlas and its size in texels.
+*/
+func (b *brickVolume) atlas(empty float64) (data []float64, width, height, depth int) {
+	ax, ay, az := b.atlasSize()
+	stored := b.storedSize()
+	width, height, depth = ax*stored, ay*stored, az*stored
+
+	data = make([]float64, width*height*depth)
+	for i := range data {
+		data[i] = empty
+	}
+
+	for i, brick := range b.bricks {
+		bx, by, bz := b.atlasPosition(i)
+
+		for z := range stored {
+			for y := range stored {
+				row := bx*stored + (by*stored+y)*width + (bz*stored+z)*width*height
+				copy(data[row:row+stored], brick[y*stored+z*stored*stored:])
+			}
+		}
+	}
+
+	return data, width, height, depth
+}
+
+/*
+Indirection volume as RGBA8, RGB is the position of the brick in the atlas
+(in bricks), and A is 255 when the brick is stored, 0 otherwise.
+*/
+func (b *brickVolume) indirectionRGBA8() []byte {
+	data := make([]byte, len(b.indirection)*4)
+
+	for i, index := range b.indirection {
+		if index == brickEmpty {
+			continue
+		}
+
+		x, y, z := b.atlasPosition(index)
+		data[i*4] = byte(x)
+		data[i*4+1] = byte(y)
+		data[i*4+2] = byte(z)
+		data[i*4+3] = 255
+	}
+
+	return data
+}
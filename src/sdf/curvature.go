@@ -0,0 +1,126 @@
+package sdf
+
+import (
+	"math"
+	"slices"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Second derivatives at a texel using central differences, in distance per texel squared
+func (f *DistanceField) hessian(x, y, z int) (h [3][3]float64) {
+	d := f.at(x, y, z)
+	offsets := [3][3]int{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+	for i := range 3 {
+		a := offsets[i]
+		h[i][i] = f.at(x+a[0], y+a[1], z+a[2]) - 2.0*d + f.at(x-a[0], y-a[1], z-a[2])
+
+		for j := i + 1; j < 3; j++ {
+			b := offsets[j]
+			h[i][j] = (f.at(x+a[0]+b[0], y+a[1]+b[1], z+a[2]+b[2]) -
+				f.at(x+a[0]-b[0], y+a[1]-b[1], z+a[2]-b[2]) -
+				f.at(x-a[0]+b[0], y-a[1]+b[1], z-a[2]+b[2]) +
+				f.at(x-a[0]-b[0], y-a[1]-b[1], z-a[2]-b[2])) * 0.25
+			h[j][i] = h[i][j]
+		}
+	}
+
+	return h
+}
+
+/*
+Mean and Gaussian curvature of the level set through a texel, from the gradient
+and the Hessian of the field. From Curvature formulas for implicit curves and
+surfaces, by Ron Goldman. Convex surfaces have positive mean curvature. texel
+is the size of a texel in distance units, the results are in 1 / distance units
+and 1 / distance units squared.
+*/
+func (f *DistanceField) curvature(x, y, z int, texel float64) (mean, gaussian float64) {
+	g := vec.Scale(f.gradient(x, y, z), 1.0/texel)
+	g2 := vec.Dot2(g)
+	if g2 == 0.0 {
+		return 0.0, 0.0
+	}
+
+	h := f.hessian(x, y, z)
+	for i := range 3 {
+		for j := range 3 {
+			h[i][j] /= texel * texel
+		}
+	}
+
+	hg := vec.Vec3{vec.Dot(h[0], g), vec.Dot(h[1], g), vec.Dot(h[2], g)}
+	trace := h[0][0] + h[1][1] + h[2][2]
+	mean = (g2*trace - vec.Dot(g, hg)) / (2.0 * g2 * math.Sqrt(g2))
+
+	// Adjugate of the Hessian
+	adj := [3]vec.Vec3{
+		{h[1][1]*h[2][2] - h[1][2]*h[1][2], h[0][2]*h[1][2] - h[0][1]*h[2][2], h[0][1]*h[1][2] - h[0][2]*h[1][1]},
+		{h[0][2]*h[1][2] - h[0][1]*h[2][2], h[0][0]*h[2][2] - h[0][2]*h[0][2], h[0][1]*h[0][2] - h[0][0]*h[1][2]},
+		{h[0][1]*h[1][2] - h[0][2]*h[1][1], h[0][1]*h[0][2] - h[0][0]*h[1][2], h[0][0]*h[1][1] - h[0][1]*h[0][1]},
+	}
+	adjG := vec.Vec3{vec.Dot(adj[0], g), vec.Dot(adj[1], g), vec.Dot(adj[2], g)}
+	gaussian = vec.Dot(g, adjG) / (g2 * g2)
+
+	return mean, gaussian
+}
+
+// Fraction of the texels near the surface whose curvature fits in the stored range
+const curvaturePercentile = 0.95
+
+/*
+Mean and Gaussian curvature of the texels within band texels of the surface,
+zero elsewhere. Also returns the ranges to store them with. Those are the
+magnitude that curvaturePercentile of the texels don't exceed, so a few noisy
+texels around edges don't take the whole precision, but no more than what the
+grid can represent, the curvature of a sphere with a one texel radius.
+*/
+func (f *DistanceField) curvatures(texel, band float64) (mean, gaussian []float64, meanMax, gaussianMax float64) {
+	mean = make([]float64, len(f.Data))
+	gaussian = make([]float64, len(f.Data))
+	var meanAbs, gaussianAbs []float64
+
+	for z := range f.Depth {
+		for y := range f.Height {
+			for x := range f.Width {
+				i := x + y*f.Width + z*f.Width*f.Height
+				if math.Abs(f.Data[i])/texel > band {
+					continue
+				}
+
+				mean[i], gaussian[i] = f.curvature(x, y, z, texel)
+				meanAbs = append(meanAbs, math.Abs(mean[i]))
+				gaussianAbs = append(gaussianAbs, math.Abs(gaussian[i]))
+			}
+		}
+	}
+
+	meanMax = vec.Clamp(percentile(meanAbs, curvaturePercentile), posSmallfloat64, 1.0/texel)
+	gaussianMax = vec.Clamp(percentile(gaussianAbs, curvaturePercentile), posSmallfloat64, 1.0/(texel*texel))
+
+	return mean, gaussian, meanMax, gaussianMax
+}
+
+// Value that a fraction p of values doesn't exceed, sorts values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+
+	slices.Sort(values)
+	return values[min(int(float64(len(values))*p), len(values)-1)]
+}
+
+// Packs two values in [-1, 1] in RG, as 8 or 16 bits signed normalized integers
+func packSignedRG(r, g []float64, bits int) []byte {
+	size := bits / 8
+	out := make([]byte, len(r)*2*size)
+
+	for i := range r {
+		putSnorm(out[i*2*size:], r[i], bits)
+		putSnorm(out[i*2*size+size:], g[i], bits)
+	}
+
+	return out
+}
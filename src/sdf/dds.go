@@ -0,0 +1,215 @@
+package sdf
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// DDSHeader represents the DDS file header
+type DDSHeader struct {
+	Magic            uint32
+	Size             uint32
+	Flags            uint32
+	Height           uint32
+	Width            uint32
+	PitchOrLinear    uint32
+	Depth            uint32
+	MipMapCount      uint32
+	Reserved1        [11]uint32
+	PixelFormatSize  uint32
+	PixelFormatFlags uint32
+	FourCC           uint32
+	RGBBitCount      uint32
+	RBitMask         uint32
+	GBitMask         uint32
+	BBitMask         uint32
+	ABitMask         uint32
+	Caps             uint32
+	Caps2            uint32
+	Caps3            uint32
+	Caps4            uint32
+	Reserved2        uint32
+}
+
+// DDSHeaderDXT10 is the extended header that follows DDSHeader when the FourCC is "DX10"
+type DDSHeaderDXT10 struct {
+	DXGIFormat        uint32
+	ResourceDimension uint32
+	MiscFlag          uint32
+	ArraySize         uint32
+	MiscFlags2        uint32
+}
+
+const (
+	DDS_MAGIC        = 0x20534444 // "DDS "
+	DDSD_CAPS        = 0x00000001
+	DDSD_HEIGHT      = 0x00000002
+	DDSD_WIDTH       = 0x00000004
+	DDSD_PITCH       = 0x00000008
+	DDSD_PIXELFORMAT = 0x00001000
+	DDSD_DEPTH       = 0x00800000
+	DDSD_MIPMAPCOUNT = 0x00020000
+	DDSD_LINEARSIZE  = 0x00080000
+	DDPF_FOURCC      = 0x00000004
+	DDPF_RGB         = 0x00000040
+	DDPF_ALPHAPIXELS = 0x00000001
+	DDSCAPS_TEXTURE  = 0x00001000
+	DDSCAPS_COMPLEX  = 0x00000008
+	DDSCAPS_MIPMAP   = 0x00400000
+	DDSCAPS2_VOLUME  = 0x00200000
+
+	DDS_FOURCC_DX10         = 0x30315844 // "DX10"
+	DDS_DIMENSION_TEXTURE3D = 4
+
+	DXGI_FORMAT_R16G16B16A16_FLOAT = 10
+	DXGI_FORMAT_R16G16B16A16_UNORM = 11
+	DXGI_FORMAT_R16G16B16A16_SNORM = 13
+	DXGI_FORMAT_R8G8B8A8_UNORM     = 28
+	DXGI_FORMAT_R8G8B8A8_SNORM     = 31
+	DXGI_FORMAT_R16G16_UNORM       = 35
+	DXGI_FORMAT_R16G16_SNORM       = 37
+	DXGI_FORMAT_R8G8_UNORM         = 49
+	DXGI_FORMAT_R8G8_SNORM         = 51
+	DXGI_FORMAT_R16_UINT           = 57
+	DXGI_FORMAT_R8_UINT            = 62
+	DXGI_FORMAT_BC4_UNORM          = 80
+	DXGI_FORMAT_BC4_SNORM          = 81
+)
+
+// Size in bytes of a 4x4 block for block compressed formats, or of a texel otherwise
+func dxgiFormatSize(format uint32) (size uint32, blockCompressed bool) {
+	switch format {
+	case DXGI_FORMAT_BC4_UNORM, DXGI_FORMAT_BC4_SNORM:
+		return 8, true
+	case DXGI_FORMAT_R8_UINT:
+		return 1, false
+	case DXGI_FORMAT_R8G8_UNORM, DXGI_FORMAT_R8G8_SNORM, DXGI_FORMAT_R16_UINT:
+		return 2, false
+	case DXGI_FORMAT_R8G8B8A8_UNORM, DXGI_FORMAT_R8G8B8A8_SNORM, DXGI_FORMAT_R16G16_UNORM, DXGI_FORMAT_R16G16_SNORM:
+		return 4, false
+	case DXGI_FORMAT_R16G16B16A16_FLOAT, DXGI_FORMAT_R16G16B16A16_UNORM, DXGI_FORMAT_R16G16B16A16_SNORM:
+		return 8, false
+	}
+
+	panic("unknown DXGI format")
+}
+
+// Save3DTextureAsDDS saves a 3D texture as a DDS file
+func Save3DTextureAsDDS(filename string, data []byte, width, height, depth, format, mipCount uint32) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Write3DTextureAsDDS(file, data, width, height, depth, format, mipCount)
+}
+
+// Write3DTextureAsDDS writes a 3D texture in the DDS format, data holds mipCount
+// levels one after the other, starting with the biggest one
+func Write3DTextureAsDDS(w io.Writer, data []byte, width, height, depth, format, mipCount uint32) error {
+	header := DDSHeader{
+		Magic:            DDS_MAGIC,
+		Size:             124,
+		Flags:            DDSD_CAPS | DDSD_HEIGHT | DDSD_WIDTH | DDSD_PIXELFORMAT | DDSD_DEPTH,
+		Height:           height,
+		Width:            width,
+		Depth:            depth,
+		PitchOrLinear:    width * height * format / 8,
+		PixelFormatSize:  8, // 32????
+		PixelFormatFlags: DDPF_ALPHAPIXELS,
+		RGBBitCount:      format,
+		RBitMask:         0x00FF0000,
+		GBitMask:         0x0000FF00,
+		BBitMask:         0x000000FF,
+		ABitMask:         0xFF000000,
+		Caps:             DDSCAPS_TEXTURE | DDSCAPS_COMPLEX,
+		Caps2:            DDSCAPS2_VOLUME,
+	}
+
+	if mipCount > 1 {
+		header.Flags |= DDSD_MIPMAPCOUNT
+		header.MipMapCount = mipCount
+		header.Caps |= DDSCAPS_MIPMAP
+	}
+
+	// Write header
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	// Write texture data
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Save3DTextureAsDDSDX10 saves a 3D texture as a DDS file with the DX10 header
+func Save3DTextureAsDDSDX10(filename string, data []byte, width, height, depth, format, mipCount uint32) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Write3DTextureAsDDSDX10(file, data, width, height, depth, format, mipCount)
+}
+
+// Write3DTextureAsDDSDX10 writes a 3D texture in the DDS format with the DX10 header,
+// for formats that can't be described with the legacy pixel format
+func Write3DTextureAsDDSDX10(w io.Writer, data []byte, width, height, depth, format, mipCount uint32) error {
+	header := DDSHeader{
+		Magic:            DDS_MAGIC,
+		Size:             124,
+		Flags:            DDSD_CAPS | DDSD_HEIGHT | DDSD_WIDTH | DDSD_PIXELFORMAT | DDSD_DEPTH,
+		Height:           height,
+		Width:            width,
+		Depth:            depth,
+		PixelFormatSize:  32,
+		PixelFormatFlags: DDPF_FOURCC,
+		FourCC:           DDS_FOURCC_DX10,
+		Caps:             DDSCAPS_TEXTURE | DDSCAPS_COMPLEX,
+		Caps2:            DDSCAPS2_VOLUME,
+	}
+
+	// Size of the top level slice for compressed formats, row pitch otherwise
+	size, blockCompressed := dxgiFormatSize(format)
+	if blockCompressed {
+		header.Flags |= DDSD_LINEARSIZE
+		header.PitchOrLinear = ((width + 3) / 4) * ((height + 3) / 4) * size
+	} else {
+		header.Flags |= DDSD_PITCH
+		header.PitchOrLinear = width * size
+	}
+
+	if mipCount > 1 {
+		header.Flags |= DDSD_MIPMAPCOUNT
+		header.MipMapCount = mipCount
+		header.Caps |= DDSCAPS_MIPMAP
+	}
+
+	header10 := DDSHeaderDXT10{
+		DXGIFormat:        format,
+		ResourceDimension: DDS_DIMENSION_TEXTURE3D,
+		ArraySize:         1,
+	}
+
+	// Write headers
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, &header10); err != nil {
+		return err
+	}
+
+	// Write texture data
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	return nil
+}
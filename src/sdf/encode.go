@@ -0,0 +1,514 @@
+package sdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Encodes the octree, and describes it
+func (r *Result) encodeADF() error {
+	var data bytes.Buffer
+	if err := r.adf.Write(&data); err != nil {
+		return err
+	}
+
+	r.Texture = Volume{Ext: "adf", Data: data.Bytes()}
+	r.Metadata = map[string]any{
+		"distance_unit":         "world",
+		"mesh_bounding_box_min": r.Mesh.Min,
+		"mesh_bounding_box_max": r.Mesh.Max,
+		"octree_root_min":       r.adf.rootMin,
+		"octree_root_size":      r.adf.rootSize,
+		"octree_nodes":          len(r.adf.nodes),
+		"octree_leaves":         len(r.adf.corners) / 8,
+		"octree_bytes":          r.adf.byteSize(),
+		"octree_tolerance":      r.options.Tolerance * texelSize(r.Field.Width, r.Field.GridMin, r.Field.GridMax, r.Field.Sampling),
+		"octree_failed_cells":   r.adfFailed,
+		"uniform_width":         r.Field.Width,
+		"uniform_height":        r.Field.Height,
+		"uniform_depth":         r.Field.Depth,
+		"uniform_bytes":         r.Field.Width * r.Field.Height * r.Field.Depth * 4,
+		"texture_format":        "adf",
+	}
+
+	return nil
+}
+
+// Quantizes the brick atlas, and adds the indirection volume
+func (r *Result) encodeBricks() error {
+	bricks := r.bricks
+	settings := r.options.settings(r.Field.Width, r.Field.Height, r.Field.Depth)
+
+	// Texels outside of any brick are as far as it gets
+	atlas, width, height, depth := bricks.atlas(r.MaxD)
+
+	data, clamped := quantize(settings, atlas, r.MinD, r.MaxD, r.options.Progress)
+	if clamped > 0 {
+		logWarning(r.options.Progress, -1, "%d values outside of the range [%f, %f] were clamped", clamped, r.MinD, r.MaxD)
+	}
+
+	r.Texture = Volume{
+		Width:  width,
+		Height: height,
+		Depth:  depth,
+		Mips:   1,
+		Bits:   int(r.options.Type),
+		Data:   data,
+	}
+
+	r.Volumes = append(r.Volumes, Volume{
+		Name:       "indirection",
+		Width:      bricks.bricksX,
+		Height:     bricks.bricksY,
+		Depth:      bricks.bricksZ,
+		Mips:       1,
+		DXGIFormat: DXGI_FORMAT_R8G8B8A8_UNORM,
+		Data:       bricks.indirectionRGBA8(),
+	})
+
+	ax, ay, az := bricks.atlasSize()
+
+	r.Metadata = map[string]any{
+		"distance_min":          r.MinD,
+		"distance_max":          r.MaxD,
+		"distance_clamped":      clamped,
+		"distance_unit":         r.options.Units,
+		"texel_size":            texelSize(r.Field.Width, r.Field.GridMin, r.Field.GridMax, r.Field.Sampling),
+		"grid_width":            r.Field.Width,
+		"grid_height":           r.Field.Height,
+		"grid_depth":            r.Field.Depth,
+		"mesh_bounding_box_min": r.Mesh.Min,
+		"mesh_bounding_box_max": r.Mesh.Max,
+		"grid_bounding_box_min": r.Field.GridMin,
+		"grid_bounding_box_max": r.Field.GridMax,
+		"grid_sampling":         r.Field.Sampling,
+		"brick_size":            bricks.brickSize,
+		"brick_apron":           1,
+		"brick_stored_size":     bricks.storedSize(),
+		"brick_count":           len(bricks.bricks),
+		"brick_band":            r.options.Band,
+		"atlas_bricks":          [3]int{ax, ay, az},
+		"texture_width":         width,
+		"texture_height":        height,
+		"texture_depth":         depth,
+		"texture_format":        fmt.Sprintf("u%d", r.options.Type),
+		"indirection_width":     bricks.bricksX,
+		"indirection_height":    bricks.bricksY,
+		"indirection_depth":     bricks.bricksZ,
+		"indirection_format":    "rgba8, rgb is the brick position in the atlas (in bricks), a is 255 for stored bricks and 0 for empty ones",
+	}
+
+	return nil
+}
+
+// Quantizes or compresses the distance field, and calculates the volumes that go with it
+func (r *Result) encodeGrid(ctx context.Context) error {
+	options := r.options
+	field := r.Field
+	settings := options.settings(field.Width, field.Height, field.Depth)
+
+	levels := []mipLevel{{
+		width:  field.Width,
+		height: field.Height,
+		depth:  field.Depth,
+		data:   field.Data,
+		minD:   field.MinD,
+		maxD:   field.MaxD,
+	}}
+
+	if options.Mips {
+		levels = buildMipChain(field)
+	}
+
+	// Signed blocks store zero distance as zero, so the range must be symmetric
+	signed := options.Compress == CompressBC4Signed
+	if signed {
+		d := max(-r.MinD, r.MaxD)
+		r.MinD, r.MaxD = -d, d
+	}
+
+	var data []byte
+	var levelsInfo []map[string]any
+	clamped := 0
+	compressionError := 0.0
+
+	// Every level is quantized with the same range, so they all decode with the same constants
+	for i, level := range levels {
+		var levelData []byte
+		var levelClamped int
+
+		if options.Compress != CompressNone {
+			var e float64
+			levelData, e, levelClamped = compressBC4(level, r.MinD, r.MaxD, signed, options.Threads)
+			compressionError = max(compressionError, e)
+		} else {
+			levelData, levelClamped = quantize(settings, level.data, r.MinD, r.MaxD, options.Progress)
+		}
+
+		if i == 0 {
+			clamped = levelClamped
+		}
+
+		data = append(data, levelData...)
+
+		levelsInfo = append(levelsInfo, map[string]any{
+			"width":        level.width,
+			"height":       level.height,
+			"depth":        level.depth,
+			"distance_min": level.minD,
+			"distance_max": level.maxD,
+		})
+	}
+
+	if clamped > 0 {
+		logWarning(r.options.Progress, -1, "%d values outside of the range [%f, %f] were clamped", clamped, r.MinD, r.MaxD)
+	}
+
+	textureFormat := fmt.Sprintf("u%d", options.Type)
+
+	switch options.Compress {
+	case CompressBC4:
+		textureFormat = "bc4_unorm"
+	case CompressBC4Signed:
+		textureFormat = "bc4_snorm"
+	}
+
+	// The error in world units, whatever the units of the distances
+	if options.Units == UnitsTexel {
+		compressionError *= texelSize(field.Width, field.GridMin, field.GridMax, field.Sampling)
+	}
+
+	if options.Compress != CompressNone {
+		logMessage(r.options.Progress, "Maximum distance error after compression: %f world units", compressionError)
+	}
+
+	// Formats that need the DX10 header
+	dxgiFormat := uint32(0)
+
+	switch {
+	case options.Compress == CompressBC4:
+		dxgiFormat = DXGI_FORMAT_BC4_UNORM
+	case options.Compress == CompressBC4Signed:
+		dxgiFormat = DXGI_FORMAT_BC4_SNORM
+	case options.Normals != NormalsNone && options.NormalPack == NormalPackRGBA && options.Type == Type16:
+		dxgiFormat = DXGI_FORMAT_R16G16B16A16_UNORM
+	case options.Normals != NormalsNone && options.NormalPack == NormalPackRGBA:
+		dxgiFormat = DXGI_FORMAT_R8G8B8A8_UNORM
+	}
+
+	var normals []vec.Vec3
+	if options.Normals != NormalsNone {
+		logMessage(r.options.Progress, "Calculating normals...")
+		normals = fieldNormals(*r.Mesh, field, options.Normals == NormalsAnalytic)
+	}
+
+	if options.NormalPack == NormalPackRGBA && normals != nil {
+		data = packNormalsRGBA(normals, data, int(options.Type))
+		textureFormat = fmt.Sprintf("rgba%d", options.Type)
+	}
+
+	r.Texture = Volume{
+		Width:      field.Width,
+		Height:     field.Height,
+		Depth:      field.Depth,
+		Mips:       len(levels),
+		DXGIFormat: dxgiFormat,
+		Bits:       int(options.Type),
+		Data:       data,
+	}
+
+	r.Metadata = map[string]any{
+		"distance_min":          r.MinD,
+		"distance_max":          r.MaxD,
+		"distance_clamped":      clamped,
+		"distance_unit":         options.Units,
+		"texel_size":            texelSize(field.Width, field.GridMin, field.GridMax, field.Sampling),
+		"texture_width":         field.Width,
+		"texture_height":        field.Height,
+		"texture_depth":         field.Depth,
+		"mesh_bounding_box_min": r.Mesh.Min,
+		"mesh_bounding_box_max": r.Mesh.Max,
+		"grid_bounding_box_min": field.GridMin,
+		"grid_bounding_box_max": field.GridMax,
+		"grid_sampling":         field.Sampling,
+		"texture_format":        textureFormat,
+		"mip_count":             len(levels),
+	}
+
+	if options.Mips {
+		r.Metadata["mip_levels"] = levelsInfo
+	}
+
+	if options.Compress != CompressNone {
+		r.Metadata["compression_max_error"] = compressionError
+	}
+
+	if options.Hybrid {
+		r.Metadata["hybrid_exact_texels"] = field.exactTexels
+	}
+
+	if options.Supersample > 1 {
+		r.Metadata["supersample"] = options.Supersample
+		r.Metadata["supersample_filter"] = options.SupersampleFilter
+	}
+
+	if options.Sign == SignFloodFill {
+		r.Metadata["sign_mode"] = options.Sign
+		r.Metadata["sign_differences"] = field.signDifferences
+	}
+
+	if r.hybrid != nil {
+		r.Metadata["hybrid_error_max"] = r.hybrid.max
+		r.Metadata["hybrid_error_mean"] = r.hybrid.mean
+		r.Metadata["hybrid_sign_differences"] = r.hybrid.signDifferent
+	}
+
+	if normals != nil {
+		r.Metadata["normal_source"] = options.Normals
+	}
+
+	if options.NormalPack == NormalPackRGBA && normals != nil {
+		r.Metadata["channels"] = []string{"normal_x * 0.5 + 0.5", "normal_y * 0.5 + 0.5", "normal_z * 0.5 + 0.5", "distance"}
+	}
+
+	if options.NormalPack == NormalPackOct && normals != nil {
+		dxgiFormat := uint32(DXGI_FORMAT_R8G8_UNORM)
+		if options.Type == Type16 {
+			dxgiFormat = DXGI_FORMAT_R16G16_UNORM
+		}
+
+		r.addVolume("normals", packNormalsOct(normals, int(options.Type)), dxgiFormat)
+		r.Metadata["normals_format"] = fmt.Sprintf("rg%d", options.Type)
+		r.Metadata["normals_channels"] = []string{"octahedral_x * 0.5 + 0.5", "octahedral_y * 0.5 + 0.5"}
+	}
+
+	// Volumes that go with the distances, each one adds its description
+	companions := []struct {
+		enabled bool
+		encode  func() error
+	}{
+		{options.Vectors != VectorsNone, r.encodeVectors},
+		{options.Triangles, r.encodeTriangles},
+		{options.Materials, r.encodeMaterials},
+		{options.Albedo != AlbedoNone, r.encodeAlbedo},
+		{options.Occlusion, r.encodeOcclusion},
+		{options.Curvature, r.encodeCurvature},
+	}
+
+	for _, c := range companions {
+		if !c.enabled {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := c.encode(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Adds a volume the size of the grid
+func (r *Result) addVolume(name string, data []byte, dxgiFormat uint32) {
+	r.Volumes = append(r.Volumes, Volume{
+		Name:       name,
+		Width:      r.Field.Width,
+		Height:     r.Field.Height,
+		Depth:      r.Field.Depth,
+		Mips:       1,
+		DXGIFormat: dxgiFormat,
+		Data:       data,
+	})
+}
+
+// Size of a texel in the units of the distances
+func (r *Result) texel() float64 {
+	if r.options.Units == UnitsTexel {
+		return 1.0
+	}
+
+	return texelSize(r.Field.Width, r.Field.GridMin, r.Field.GridMax, r.Field.Sampling)
+}
+
+// Adds the closest point vector volume
+func (r *Result) encodeVectors() error {
+	logMessage(r.options.Progress, "Calculating closest point vectors...")
+	vectors := closestVectors(*r.Mesh, r.Field)
+
+	// Vectors use the same units as the distances
+	if r.options.Units == UnitsTexel {
+		t := texelSize(r.Field.Width, r.Field.GridMin, r.Field.GridMax, r.Field.Sampling)
+		for i := range vectors {
+			vectors[i] = vec.Scale(vectors[i], 1.0/t)
+		}
+	}
+
+	bits := 0
+	dxgiFormat := uint32(DXGI_FORMAT_R16G16B16A16_FLOAT)
+	format := "rgba16f"
+	scale := 1.0
+
+	if r.options.Vectors == VectorsSnorm {
+		bits = int(r.options.Type)
+		dxgiFormat = DXGI_FORMAT_R8G8B8A8_SNORM
+		format = "rgba8_snorm"
+		if bits == 16 {
+			dxgiFormat = DXGI_FORMAT_R16G16B16A16_SNORM
+			format = "rgba16_snorm"
+		}
+
+		// Longest component, so every vector fits in [-1, 1]
+		scale = posSmallfloat64
+		for _, v := range vectors {
+			scale = vec.MaxN(scale, math.Abs(v[0]), math.Abs(v[1]), math.Abs(v[2]))
+		}
+	}
+
+	r.addVolume("vectors", packVectors(vectors, r.Field.Data, r.options.VectorSign, bits, scale), dxgiFormat)
+
+	alpha := "unused, 0"
+	if r.options.VectorSign {
+		alpha = "sign of the distance, 1 or -1"
+	}
+
+	r.Metadata["vectors_format"] = format
+	r.Metadata["vectors_scale"] = scale
+	r.Metadata["vectors_unit"] = r.options.Units
+	r.Metadata["vectors_channels"] = []string{
+		"(closest_x - x) / scale",
+		"(closest_y - y) / scale",
+		"(closest_z - z) / scale",
+		alpha,
+	}
+
+	return nil
+}
+
+// Adds the closest triangle and barycentric coordinates raw volumes
+func (r *Result) encodeTriangles() error {
+	logMessage(r.options.Progress, "Calculating barycentric coordinates...")
+	_, barycentrics := closestPoints(*r.Mesh, r.Field)
+
+	r.Volumes = append(r.Volumes,
+		Volume{Name: "triangles", Ext: "bin", Data: packTriangleIDs(r.Field.Triangles)},
+		Volume{Name: "barycentrics", Ext: "bin", Data: packBarycentrics(barycentrics)},
+	)
+
+	r.Metadata["triangles_format"] = "u32, index of the closest triangle, faces are numbered in file order from 0"
+	r.Metadata["barycentrics_format"] = "3 x f32, weights of the closest point for the 3 vertices of the triangle, in face order"
+
+	return nil
+}
+
+// Adds the material index volume
+func (r *Result) encodeMaterials() error {
+	if len(r.Mesh.Materials) == 0 {
+		logWarning(r.options.Progress, -1, "the mesh has no usemtl or g statements, skipping the material volume")
+		return nil
+	}
+
+	data, bits := packMaterials(*r.Mesh, r.Field.Triangles)
+	dxgiFormat := uint32(DXGI_FORMAT_R8_UINT)
+	if bits == 16 {
+		dxgiFormat = DXGI_FORMAT_R16_UINT
+	}
+
+	r.addVolume("materials", data, dxgiFormat)
+
+	source := "usemtl"
+	if r.Mesh.MaterialsFromGroups {
+		source = "g"
+	}
+
+	r.Metadata["materials_format"] = fmt.Sprintf("u%d", bits)
+	r.Metadata["materials_source"] = source
+	r.Metadata["materials"] = r.Mesh.Materials
+
+	return nil
+}
+
+// Adds the color volume
+func (r *Result) encodeAlbedo() error {
+	logMessage(r.options.Progress, "Sampling colors...")
+
+	var data []byte
+	var err error
+
+	if r.options.Albedo == AlbedoVertex {
+		data, err = vertexColors(*r.Mesh, r.Field)
+	} else {
+		data, err = textureColors(*r.Mesh, r.Field, r.options.Progress)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	r.addVolume("albedo", data, DXGI_FORMAT_R8G8B8A8_UNORM)
+	r.Metadata["albedo_format"] = "rgba8"
+	r.Metadata["albedo_source"] = r.options.Albedo
+
+	return nil
+}
+
+// Adds the ambient occlusion and thickness volume
+func (r *Result) encodeOcclusion() error {
+	logMessage(r.options.Progress, "Calculating ambient occlusion and thickness...")
+
+	texel := r.texel()
+	occlusion, thickness, maxThickness := r.Field.occlusionAndThickness(texel, r.options.Band, r.options.Threads)
+	for i := range thickness {
+		thickness[i] /= max(maxThickness, posSmallfloat64)
+	}
+
+	dxgiFormat := uint32(DXGI_FORMAT_R8G8_UNORM)
+	if r.options.Type == Type16 {
+		dxgiFormat = DXGI_FORMAT_R16G16_UNORM
+	}
+
+	r.addVolume("occlusion", packRG(occlusion, thickness, int(r.options.Type)), dxgiFormat)
+	r.Metadata["occlusion_format"] = fmt.Sprintf("rg%d", r.options.Type)
+	r.Metadata["occlusion_channels"] = []string{"ambient occlusion, 1 is not occluded", "thickness / thickness_max"}
+	r.Metadata["thickness_max"] = maxThickness * texel
+	r.Metadata["occlusion_band"] = r.options.Band
+
+	return nil
+}
+
+// Adds the curvature volume
+func (r *Result) encodeCurvature() error {
+	logMessage(r.options.Progress, "Calculating curvature...")
+
+	mean, gaussian, meanMax, gaussianMax := r.Field.curvatures(r.texel(), r.options.Band)
+	clamped := 0
+	for i := range mean {
+		mean[i] /= meanMax
+		gaussian[i] /= gaussianMax
+		if math.Abs(mean[i]) > 1.0 || math.Abs(gaussian[i]) > 1.0 {
+			clamped++
+		}
+	}
+
+	dxgiFormat := uint32(DXGI_FORMAT_R8G8_SNORM)
+	if r.options.Type == Type16 {
+		dxgiFormat = DXGI_FORMAT_R16G16_SNORM
+	}
+
+	r.addVolume("curvature", packSignedRG(mean, gaussian, int(r.options.Type)), dxgiFormat)
+	r.Metadata["curvature_format"] = fmt.Sprintf("rg%d_snorm", r.options.Type)
+	r.Metadata["curvature_channels"] = []string{"mean curvature / curvature_mean_max, positive is convex", "Gaussian curvature / curvature_gaussian_max"}
+	r.Metadata["curvature_mean_max"] = meanMax
+	r.Metadata["curvature_gaussian_max"] = gaussianMax
+	r.Metadata["curvature_band"] = r.options.Band
+	r.Metadata["curvature_clamped"] = clamped
+
+	return nil
+}
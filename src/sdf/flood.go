@@ -0,0 +1,174 @@
+package sdf
+
+import "math"
+
+// Calls f with the index of each of the 6 neighbours of texel i that are in the grid
+func forNeighbours(i, width, height, depth int, f func(j int)) {
+	x := i % width
+	y := i / width % height
+	z := i / (width * height)
+
+	if x > 0 {
+		f(i - 1)
+	}
+	if x < width-1 {
+		f(i + 1)
+	}
+	if y > 0 {
+		f(i - width)
+	}
+	if y < height-1 {
+		f(i + width)
+	}
+	if z > 0 {
+		f(i - width*height)
+	}
+	if z < depth-1 {
+		f(i + width*height)
+	}
+}
+
+// Marks the texels reached by a 6-connected flood fill from the border of
+// the grid through the open texels
+func floodExterior(width, height, depth int, open []bool) []bool {
+	exterior := make([]bool, len(open))
+	var queue []int
+
+	push := func(i int) {
+		if open[i] && !exterior[i] {
+			exterior[i] = true
+			queue = append(queue, i)
+		}
+	}
+
+	for z := range depth {
+		for y := range height {
+			for x := range width {
+				if x == 0 || y == 0 || z == 0 || x == width-1 || y == height-1 || z == depth-1 {
+					push(x + y*width + z*width*height)
+				}
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		i := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		forNeighbours(i, width, height, depth, push)
+	}
+
+	return exterior
+}
+
+/*
+Sets the signs of the distances from a flood fill of the exterior instead of
+the normals of the triangles. shell marks the texels on the surface, the fill
+from the border of the grid goes around them, and the texels it doesn't reach
+are inside. Shell texels take the side of the closest texels off the shell
+where their distances agree, neighbours can't be further apart than a texel
+of size h. Returns the number of texels whose sign changed, and the number of
+texels inside.
+*/
+func floodFillSigns(data []float64, width, height, depth int, h float64, shell []bool) (changed, interior int) {
+	open := make([]bool, len(shell))
+	for i := range shell {
+		open[i] = !shell[i]
+	}
+
+	exterior := floodExterior(width, height, depth, open)
+
+	// 1 outside, -1 inside, 0 not known yet
+	side := make([]int8, len(data))
+	var frontier []int
+
+	for i := range data {
+		if shell[i] {
+			continue
+		}
+
+		side[i] = 1
+		if !exterior[i] {
+			side[i] = -1
+			interior++
+		}
+
+		frontier = append(frontier, i)
+	}
+
+	// Into the shell one layer at a time. A texel takes the side where its
+	// distance is closest to the distances of the neighbours on the layers
+	// before, only a texel between them and the surface can be on either
+	// side. Then the side most of them are on, and the triangles break ties.
+	queued := make([]bool, len(data))
+	signed := make([]float64, len(data))
+
+	for len(frontier) > 0 {
+		var next []int
+
+		for _, i := range frontier {
+			signed[i] = math.Abs(data[i]) * float64(side[i])
+
+			forNeighbours(i, width, height, depth, func(j int) {
+				if side[j] == 0 && !queued[j] {
+					queued[j] = true
+					next = append(next, j)
+				}
+			})
+		}
+
+		sides := make([]int8, len(next))
+		for k, j := range next {
+			u := math.Abs(data[j])
+			var outside, inside float64
+			votes := 0
+
+			forNeighbours(j, width, height, depth, func(i int) {
+				if side[i] == 0 {
+					return
+				}
+
+				outside = max(outside, math.Abs(u-signed[i])-h)
+				inside = max(inside, math.Abs(-u-signed[i])-h)
+				votes += int(side[i])
+			})
+
+			switch {
+			case outside < inside:
+				sides[k] = 1
+			case inside < outside:
+				sides[k] = -1
+			case votes > 0:
+				sides[k] = 1
+			case votes < 0:
+				sides[k] = -1
+			case data[j] < 0.0:
+				sides[k] = -1
+			default:
+				sides[k] = 1
+			}
+		}
+
+		for k, j := range next {
+			side[j] = sides[k]
+		}
+
+		frontier = next
+	}
+
+	for i, d := range data {
+		// Only when the whole grid is shell
+		if side[i] == 0 {
+			continue
+		}
+
+		signed := math.Abs(d) * float64(side[i])
+		if (signed < 0.0) != (d < 0.0) {
+			changed++
+		}
+
+		data[i] = signed
+	}
+
+	return changed, interior
+}
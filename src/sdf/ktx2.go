@@ -0,0 +1,308 @@
+package sdf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// KTX2Header represents the KTX2 file header, with the index of the sections that follow
+type KTX2Header struct {
+	Identifier             [12]byte
+	VkFormat               uint32
+	TypeSize               uint32
+	PixelWidth             uint32
+	PixelHeight            uint32
+	PixelDepth             uint32
+	LayerCount             uint32
+	FaceCount              uint32
+	LevelCount             uint32
+	SupercompressionScheme uint32
+	DFDByteOffset          uint32
+	DFDByteLength          uint32
+	KVDByteOffset          uint32
+	KVDByteLength          uint32
+	SGDByteOffset          uint64
+	SGDByteLength          uint64
+}
+
+// KTX2Level is an entry of the level index that follows KTX2Header, one per mip level
+type KTX2Level struct {
+	ByteOffset             uint64
+	ByteLength             uint64
+	UncompressedByteLength uint64
+}
+
+var KTX2_IDENTIFIER = [12]byte{0xAB, 'K', 'T', 'X', ' ', '2', '0', 0xBB, '\r', '\n', 0x1A, '\n'}
+
+const (
+	VK_FORMAT_R8_UNORM            = 9
+	VK_FORMAT_R8_UINT             = 13
+	VK_FORMAT_R8G8_UNORM          = 16
+	VK_FORMAT_R8G8_SNORM          = 17
+	VK_FORMAT_R8G8B8A8_UNORM      = 37
+	VK_FORMAT_R8G8B8A8_SNORM      = 38
+	VK_FORMAT_R16_UNORM           = 70
+	VK_FORMAT_R16_UINT            = 74
+	VK_FORMAT_R16G16_UNORM        = 77
+	VK_FORMAT_R16G16_SNORM        = 78
+	VK_FORMAT_R16G16B16A16_UNORM  = 91
+	VK_FORMAT_R16G16B16A16_SNORM  = 92
+	VK_FORMAT_R16G16B16A16_SFLOAT = 97
+	VK_FORMAT_BC4_UNORM_BLOCK     = 139
+	VK_FORMAT_BC4_SNORM_BLOCK     = 140
+
+	// Data format descriptor values, from the Khronos Data Format Specification
+	KHR_DF_VERSIONNUMBER_1_3        = 2
+	KHR_DF_MODEL_RGBSDA             = 1
+	KHR_DF_MODEL_BC4                = 131
+	KHR_DF_PRIMARIES_BT709          = 1
+	KHR_DF_TRANSFER_LINEAR          = 1
+	KHR_DF_CHANNEL_RGBSDA_ALPHA     = 15
+	KHR_DF_SAMPLE_DATATYPE_SIGNED   = 0x40
+	KHR_DF_SAMPLE_DATATYPE_FLOAT    = 0x80
+	KHR_DF_SAMPLE_FLOAT_ONE         = 0x3F800000
+	KHR_DF_SAMPLE_FLOAT_MINUS_ONE   = 0xBF800000
+	KHR_DF_BASIC_BLOCK_HEADER_BYTES = 24
+	KHR_DF_BASIC_BLOCK_SAMPLE_BYTES = 16
+)
+
+// Channels of a Vulkan format, for its data format descriptor
+type vkFormatInfo struct {
+	channels int  // In RGBA order
+	bits     int  // Bits of each channel, the whole block for block compressed formats
+	signed   bool // Signed normalized, or signed float
+	float    bool
+	integer  bool // Not normalized
+	block    bool // 4x4 blocks
+}
+
+var vkFormats = map[uint32]vkFormatInfo{
+	VK_FORMAT_R8_UNORM:            {channels: 1, bits: 8},
+	VK_FORMAT_R8_UINT:             {channels: 1, bits: 8, integer: true},
+	VK_FORMAT_R8G8_UNORM:          {channels: 2, bits: 8},
+	VK_FORMAT_R8G8_SNORM:          {channels: 2, bits: 8, signed: true},
+	VK_FORMAT_R8G8B8A8_UNORM:      {channels: 4, bits: 8},
+	VK_FORMAT_R8G8B8A8_SNORM:      {channels: 4, bits: 8, signed: true},
+	VK_FORMAT_R16_UNORM:           {channels: 1, bits: 16},
+	VK_FORMAT_R16_UINT:            {channels: 1, bits: 16, integer: true},
+	VK_FORMAT_R16G16_UNORM:        {channels: 2, bits: 16},
+	VK_FORMAT_R16G16_SNORM:        {channels: 2, bits: 16, signed: true},
+	VK_FORMAT_R16G16B16A16_UNORM:  {channels: 4, bits: 16},
+	VK_FORMAT_R16G16B16A16_SNORM:  {channels: 4, bits: 16, signed: true},
+	VK_FORMAT_R16G16B16A16_SFLOAT: {channels: 4, bits: 16, signed: true, float: true},
+	VK_FORMAT_BC4_UNORM_BLOCK:     {channels: 1, bits: 64, block: true},
+	VK_FORMAT_BC4_SNORM_BLOCK:     {channels: 1, bits: 64, signed: true, block: true},
+}
+
+// Vulkan format of a DXGI format
+func dxgiToVkFormat(format uint32) uint32 {
+	switch format {
+	case DXGI_FORMAT_R8_UINT:
+		return VK_FORMAT_R8_UINT
+	case DXGI_FORMAT_R16_UINT:
+		return VK_FORMAT_R16_UINT
+	case DXGI_FORMAT_R8G8_UNORM:
+		return VK_FORMAT_R8G8_UNORM
+	case DXGI_FORMAT_R8G8_SNORM:
+		return VK_FORMAT_R8G8_SNORM
+	case DXGI_FORMAT_R16G16_UNORM:
+		return VK_FORMAT_R16G16_UNORM
+	case DXGI_FORMAT_R16G16_SNORM:
+		return VK_FORMAT_R16G16_SNORM
+	case DXGI_FORMAT_R8G8B8A8_UNORM:
+		return VK_FORMAT_R8G8B8A8_UNORM
+	case DXGI_FORMAT_R8G8B8A8_SNORM:
+		return VK_FORMAT_R8G8B8A8_SNORM
+	case DXGI_FORMAT_R16G16B16A16_UNORM:
+		return VK_FORMAT_R16G16B16A16_UNORM
+	case DXGI_FORMAT_R16G16B16A16_SNORM:
+		return VK_FORMAT_R16G16B16A16_SNORM
+	case DXGI_FORMAT_R16G16B16A16_FLOAT:
+		return VK_FORMAT_R16G16B16A16_SFLOAT
+	case DXGI_FORMAT_BC4_UNORM:
+		return VK_FORMAT_BC4_UNORM_BLOCK
+	case DXGI_FORMAT_BC4_SNORM:
+		return VK_FORMAT_BC4_SNORM_BLOCK
+	}
+
+	panic("unknown DXGI format")
+}
+
+// Vulkan format of the volume, the legacy DDS header is only used for single channel unorm textures
+func (v *Volume) vkFormat() uint32 {
+	switch {
+	case v.DXGIFormat != 0:
+		return dxgiToVkFormat(v.DXGIFormat)
+	case v.Bits == 16:
+		return VK_FORMAT_R16_UNORM
+	default:
+		return VK_FORMAT_R8_UNORM
+	}
+}
+
+// Basic data format descriptor of a format, with its total size in front
+func ktx2DFD(info vkFormatInfo) []uint32 {
+	samples := info.channels
+	blockSize := KHR_DF_BASIC_BLOCK_HEADER_BYTES + KHR_DF_BASIC_BLOCK_SAMPLE_BYTES*samples
+
+	model := uint32(KHR_DF_MODEL_RGBSDA)
+	dimensions := uint32(0)
+	bytesPlane := uint32(info.channels * info.bits / 8)
+	if info.block {
+		model = KHR_DF_MODEL_BC4
+		dimensions = 3 | 3<<8 // 4x4x1x1, each stored minus one
+	}
+
+	dfd := []uint32{
+		uint32(4 + blockSize),
+		0, // Khronos vendor, basic descriptor type
+		KHR_DF_VERSIONNUMBER_1_3 | uint32(blockSize)<<16,
+		model | KHR_DF_PRIMARIES_BT709<<8 | KHR_DF_TRANSFER_LINEAR<<16,
+		dimensions,
+		bytesPlane,
+		0,
+	}
+
+	for i := range samples {
+		channel := uint32(i)
+		if i == 3 {
+			channel = KHR_DF_CHANNEL_RGBSDA_ALPHA
+		}
+		if info.signed {
+			channel |= KHR_DF_SAMPLE_DATATYPE_SIGNED
+		}
+		if info.float {
+			channel |= KHR_DF_SAMPLE_DATATYPE_FLOAT
+		}
+
+		// Values that map to 0 and 1, or -1 and 1 when signed
+		var lower, upper uint32
+		switch {
+		case info.float:
+			lower, upper = KHR_DF_SAMPLE_FLOAT_MINUS_ONE, KHR_DF_SAMPLE_FLOAT_ONE
+		case info.integer:
+			lower, upper = 0, 1
+		case info.block && info.signed:
+			lower, upper = 0x80000000, 0x7FFFFFFF
+		case info.block:
+			lower, upper = 0, 0xFFFFFFFF
+		case info.signed:
+			limit := int32(1)<<(info.bits-1) - 1
+			lower, upper = uint32(-limit), uint32(limit)
+		default:
+			lower, upper = 0, 1<<info.bits-1
+		}
+
+		dfd = append(dfd,
+			uint32(i*info.bits)|uint32(info.bits-1)<<16|channel<<24,
+			0, // Sample position
+			lower,
+			upper,
+		)
+	}
+
+	return dfd
+}
+
+// Save3DTextureAsKTX2 saves a 3D texture as a KTX2 file
+func Save3DTextureAsKTX2(filename string, data []byte, width, height, depth, format, mipCount uint32) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return Write3DTextureAsKTX2(file, data, width, height, depth, format, mipCount)
+}
+
+/*
+Write3DTextureAsKTX2 writes a 3D texture in the KTX2 format, format being a
+Vulkan format. data holds mipCount levels one after the other, starting with the
+biggest one, like for DDS files, and the file has them the other way around as
+KTX2 wants, each one aligned to its texel or block size.
+*/
+func Write3DTextureAsKTX2(w io.Writer, data []byte, width, height, depth, format, mipCount uint32) error {
+	info, ok := vkFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown Vulkan format %d", format)
+	}
+
+	mipCount = max(mipCount, 1)
+	texelBytes := uint64(info.channels * info.bits / 8)
+	alignment := max(texelBytes, 4)
+	typeSize := uint32(info.bits / 8)
+	if info.block {
+		typeSize = 1
+	}
+
+	// Where each level is in data
+	levels := make([]KTX2Level, mipCount)
+	offset := uint64(0)
+	for i := range levels {
+		x, y, z := uint64(max(width>>i, 1)), uint64(max(height>>i, 1)), uint64(max(depth>>i, 1))
+		if info.block {
+			x, y = (x+3)/4, (y+3)/4
+		}
+
+		levels[i].ByteOffset = offset
+		levels[i].ByteLength = x * y * z * texelBytes
+		levels[i].UncompressedByteLength = levels[i].ByteLength
+		offset += levels[i].ByteLength
+	}
+
+	if offset != uint64(len(data)) {
+		return fmt.Errorf("%d levels of %dx%dx%d texels take %d bytes, not %d", mipCount, width, height, depth, offset, len(data))
+	}
+
+	dfd := ktx2DFD(info)
+	dfdOffset := uint32(binary.Size(KTX2Header{}) + binary.Size(levels))
+
+	header := KTX2Header{
+		Identifier:    KTX2_IDENTIFIER,
+		VkFormat:      format,
+		TypeSize:      typeSize,
+		PixelWidth:    width,
+		PixelHeight:   height,
+		PixelDepth:    depth,
+		FaceCount:     1,
+		LevelCount:    mipCount,
+		DFDByteOffset: dfdOffset,
+		DFDByteLength: uint32(len(dfd) * 4),
+	}
+
+	// Smallest level first
+	var body []byte
+	fileOffset := uint64(dfdOffset) + uint64(len(dfd)*4)
+	for i := len(levels) - 1; i >= 0; i-- {
+		padding := (alignment - fileOffset%alignment) % alignment
+		body = append(body, make([]byte, padding)...)
+		fileOffset += padding
+
+		level := data[levels[i].ByteOffset : levels[i].ByteOffset+levels[i].ByteLength]
+		body = append(body, level...)
+		levels[i].ByteOffset = fileOffset
+		fileOffset += levels[i].ByteLength
+	}
+
+	// Write headers
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, levels); err != nil {
+		return err
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, dfd); err != nil {
+		return err
+	}
+
+	// Write texture data
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,930 @@
+package sdf
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+type Triangle [3]uint32
+
+type edgeKey struct {
+	A, B uint32
+}
+
+type Mesh struct {
+	Vertices  []vec.Vec3
+	Triangles []Triangle
+	Min       vec.Vec3 // Bounding box bottom corner
+	Max       vec.Vec3 // Bounding box top corner
+
+	// Vertex colors in [0, 1], nil when the file has none
+	Colors []vec.Vec3
+
+	// Material names from usemtl, or group names from g when there are no
+	// materials, and the index of the material of each triangle
+	Materials           []string
+	TriangleMaterials   []uint16
+	MaterialsFromGroups bool
+
+	// Materials from the mtllib files, by name
+	MaterialLibrary map[string]Material
+
+	// Texture coordinates, and their indices for each triangle,
+	// noTexCoord when the face has no texture coordinates
+	TexCoords         [][2]float64
+	TriangleTexCoords []Triangle
+
+	// Problems found while loading or checking the mesh
+	Warnings []Warning
+
+	// Opens the textures of the materials, nil when they can't be opened
+	open Opener
+}
+
+// Opener opens the files an OBJ file refers to, material libraries and
+// textures, by their name relative to the OBJ file.
+type Opener func(name string) (io.ReadCloser, error)
+
+// Opener for the files next to path
+func dirOpener(path string) Opener {
+	dir := filepath.Dir(path)
+
+	return func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, name))
+	}
+}
+
+const noTexCoord = math.MaxUint32
+
+// Names used by a mesh, in order of appearance, and the index of the name of each triangle
+type nameTable struct {
+	names     []string
+	indices   map[string]uint16
+	triangles []uint16
+	used      bool // A statement setting the name was found
+}
+
+func (t *nameTable) addTriangle(name string) {
+	if t.indices == nil {
+		t.indices = map[string]uint16{}
+	}
+
+	index, ok := t.indices[name]
+	if !ok {
+		index = uint16(len(t.names))
+		t.indices[name] = index
+		t.names = append(t.names, name)
+	}
+
+	t.triangles = append(t.triangles, index)
+}
+
+var posBigfloat64 = math.Nextafter(math.Inf(1.0), -1.0)
+var negBigfloat64 = math.Nextafter(math.Inf(-1.0), 1.0)
+var posSmallfloat64 = math.Nextafter(0.0, 1.0)
+var negSmallfloat64 = math.Nextafter(0.0, -1.0)
+
+// UnionBounds returns the bounding box that contains all the meshes
+func UnionBounds(meshes []*Mesh) (boundsMin, boundsMax vec.Vec3) {
+	boundsMin = vec.Vec3{posBigfloat64, posBigfloat64, posBigfloat64}
+	boundsMax = vec.Vec3{negBigfloat64, negBigfloat64, negBigfloat64}
+
+	for _, mesh := range meshes {
+		for i := range 3 {
+			boundsMin[i] = min(boundsMin[i], mesh.Min[i])
+			boundsMax[i] = max(boundsMax[i], mesh.Max[i])
+		}
+	}
+
+	return boundsMin, boundsMax
+}
+
+// Calculate other dimensions in case only one is given, using cubic
+// texels, because there's no clear advantage to using square textures,
+// and add 0.5 texels on each side of the mesh to avoid artifacts.
+// Every axis has the spacing of the biggest side, and as many texels as it
+// takes to cover the mesh with the same border, so the texels are cubic.
+// The first and last samples are on the returned box with corner sampling,
+// with center sampling the box is half a texel bigger, around the texels.
+func calculateGridSize(meshMin, meshMax vec.Vec3, resolution int, sampling Sampling) (w, h, d int, gridMin, gridMax vec.Vec3) {
+	meshSize := vec.Sub(meshMax, meshMin)
+	biggestSide := vec.Max3(meshSize[0], meshSize[1], meshSize[2])
+
+	// resolution - 2 texels over the biggest side, plus half a texel on each side
+	texel := biggestSide / float64(resolution-2)
+
+	var size [3]int
+	var gridSize vec.Vec3
+	for i := range 3 {
+		size[i] = resolution
+		if meshSize[i] < biggestSide {
+			size[i] = min(int(math.Ceil(meshSize[i]/texel))+2, resolution)
+		}
+
+		gridSize[i] = float64(size[i]-1) * texel
+	}
+	w, h, d = size[0], size[1], size[2]
+
+	diff := vec.Scale(vec.Sub(gridSize, meshSize), 0.5)
+	gridMin = vec.Sub(meshMin, diff)
+	gridMax = vec.Add(meshMax, diff)
+
+	if sampling == SamplingCenter {
+		half := vec.Vec3{0.5 * texel, 0.5 * texel, 0.5 * texel}
+		gridMin = vec.Sub(gridMin, half)
+		gridMax = vec.Add(gridMax, half)
+	}
+
+	return w, h, d, gridMin, gridMax
+}
+
+// Returns triangle bounding box
+func getTriangleAABB(v0, v1, v2 vec.Vec3) (vec.Vec3, vec.Vec3) {
+	var min vec.Vec3
+	var max vec.Vec3
+
+	for i := range 3 {
+		min[i] = vec.Min3(v0[i], v1[i], v2[i])
+		max[i] = vec.Max3(v0[i], v1[i], v2[i])
+	}
+
+	return min, max
+}
+
+// Returns a list of triangles on each box square
+func (m *Mesh) createTriangleLists(width, height, depth int, gridMin, gridMax vec.Vec3) [][]int {
+	triangles := make([][]int, width*height*depth)
+
+	for triangleIdx, triangle := range m.Triangles {
+		v0 := m.Vertices[triangle[0]]
+		v1 := m.Vertices[triangle[1]]
+		v2 := m.Vertices[triangle[2]]
+
+		tMin, tMax := getTriangleAABB(v0, v1, v2)
+		s := [3]int{width - 1, height - 1, depth - 1}
+		var minIdx [3]int
+		var maxIdx [3]int
+
+		// calculate the min and max indices of the triangle in the grid
+		for i := range 3 {
+			minIdx[i] = int(math.Floor((tMin[i] - gridMin[i]) / (gridMax[i] - gridMin[i]) * float64(s[i])))
+			maxIdx[i] = int(math.Ceil((tMax[i] - gridMin[i]) / (gridMax[i] - gridMin[i]) * float64(s[i])))
+		}
+
+		for z := vec.Max(0, minIdx[2]); z <= vec.Min(depth-1, maxIdx[2]); z++ {
+			for y := vec.Max(0, minIdx[1]); y <= vec.Min(height-1, maxIdx[1]); y++ {
+				for x := vec.Max(0, minIdx[0]); x <= vec.Min(width-1, maxIdx[0]); x++ {
+					triangles[x+y*width+z*width*height] = append(triangles[x+y*width+z*width*height], triangleIdx)
+				}
+			}
+		}
+	}
+
+	return triangles
+}
+
+// Smallest distance between neighbouring cells of the triangle lists, infinite
+// when there's only one
+func listCellSize(width, height, depth int, gridMin, gridMax vec.Vec3) float64 {
+	size := math.Inf(1)
+	for i, n := range [3]int{width, height, depth} {
+		if n > 1 {
+			size = min(size, (gridMax[i]-gridMin[i])/float64(n-1))
+		}
+	}
+
+	return size
+}
+
+// Every edge must be shared by exactly two triangles
+func checkWatertight(triangles []Triangle) error {
+	edgeCount := make(map[edgeKey]int)
+
+	for _, triangle := range triangles {
+		edges := [3][2]uint32{
+			{triangle[0], triangle[1]},
+			{triangle[1], triangle[2]},
+			{triangle[2], triangle[0]},
+		}
+
+		for _, e := range edges {
+			// Sort the edge to make it undirected
+			a, b := e[0], e[1]
+			if a > b {
+				a, b = b, a
+			}
+			key := edgeKey{A: a, B: b}
+			edgeCount[key]++
+		}
+	}
+
+	for _, count := range edgeCount {
+		if count != 2 {
+			return fmt.Errorf("mesh is not watertight")
+		}
+	}
+
+	return nil
+}
+
+// LoadMesh loads a mesh from an OBJ or PLY file, depending on the extension.
+func LoadMesh(path string) (*Mesh, error) {
+	if strings.EqualFold(filepath.Ext(path), ".ply") {
+		return LoadPLY(path)
+	}
+
+	return LoadOBJ(path)
+}
+
+// LoadOBJ loads a mesh from an OBJ file, and its material libraries.
+func LoadOBJ(path string) (*Mesh, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadOBJ(file, dirOpener(path))
+}
+
+// ReadOBJ reads a mesh in the OBJ format.
+// It parses the vertices and triangular faces, and calculates the bounding box.
+// Material libraries and textures are opened with open, or ignored when it's nil.
+func ReadOBJ(r io.Reader, open Opener) (*Mesh, error) {
+	verts := make(map[vec.Vec3][]int)
+	duplicated := 0
+
+	model := &Mesh{
+		Min:  vec.Vec3{posBigfloat64, posBigfloat64, posBigfloat64},
+		Max:  vec.Vec3{negBigfloat64, negBigfloat64, negBigfloat64},
+		open: open,
+	}
+
+	var materials, groups nameTable
+	hasColors := false
+	material := "default"
+	group := "default"
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		if len(tokens) == 0 {
+			continue
+		}
+
+		switch tokens[0] {
+		case "mtllib":
+			if open == nil {
+				continue
+			}
+
+			for _, name := range tokens[1:] {
+				library, err := loadMTL(open, name)
+				if err != nil {
+					model.Warnings = append(model.Warnings, Warning{fmt.Sprintf("can't load material library: %v", err), -1})
+					continue
+				}
+
+				if model.MaterialLibrary == nil {
+					model.MaterialLibrary = map[string]Material{}
+				}
+
+				for name, material := range library {
+					model.MaterialLibrary[name] = material
+				}
+			}
+
+		case "vt":
+			if len(tokens) < 3 {
+				return nil, fmt.Errorf("unexpected number of texture coordinates: %s", line)
+			}
+
+			u, _ := strconv.ParseFloat(tokens[1], 64)
+			v, _ := strconv.ParseFloat(tokens[2], 64)
+			model.TexCoords = append(model.TexCoords, [2]float64{u, v})
+
+		case "usemtl":
+			material = strings.Join(tokens[1:], " ")
+			materials.used = true
+
+		case "g":
+			group = "default"
+			if len(tokens) > 1 {
+				group = strings.Join(tokens[1:], " ")
+			}
+			groups.used = true
+
+		case "v":
+			// x y z, or x y z r g b
+			if len(tokens) != 4 && len(tokens) != 7 {
+				return nil, fmt.Errorf("unexpected number of vertices: %s", line)
+			}
+
+			color := vec.Vec3{1.0, 1.0, 1.0}
+			if len(tokens) == 7 {
+				hasColors = true
+				for i := range 3 {
+					color[i], _ = strconv.ParseFloat(tokens[4+i], 64)
+				}
+			}
+			model.Colors = append(model.Colors, color)
+
+			x, _ := strconv.ParseFloat(tokens[1], 64)
+			y, _ := strconv.ParseFloat(tokens[2], 64)
+			z, _ := strconv.ParseFloat(tokens[3], 64)
+			vertex := vec.Vec3{float64(x), float64(y), float64(z)}
+			verts[vertex] = append(verts[vertex], len(model.Vertices))
+			model.Vertices = append(model.Vertices, vertex)
+
+			model.Min[0] = min(model.Min[0], float64(x))
+			model.Min[1] = min(model.Min[1], float64(y))
+			model.Min[2] = min(model.Min[2], float64(z))
+
+			model.Max[0] = max(model.Max[0], float64(x))
+			model.Max[1] = max(model.Max[1], float64(y))
+			model.Max[2] = max(model.Max[2], float64(z))
+
+			if len(verts[vertex]) > 1 {
+				duplicated++
+			}
+
+		case "f":
+			if len(tokens) != 4 {
+				return nil, fmt.Errorf("only triangular faces supported: %s", line)
+			}
+
+			v0, _ := strconv.Atoi(strings.Split(tokens[1], "/")[0])
+			v1, _ := strconv.Atoi(strings.Split(tokens[2], "/")[0])
+			v2, _ := strconv.Atoi(strings.Split(tokens[3], "/")[0])
+
+			var triangle Triangle
+			triangle = Triangle{uint32(v0 - 1), uint32(v1 - 1), uint32(v2 - 1)}
+			model.Triangles = append(model.Triangles, triangle)
+
+			// v/vt/vn, texture coordinates are optional
+			texCoords := Triangle{noTexCoord, noTexCoord, noTexCoord}
+			for i := range 3 {
+				parts := strings.Split(tokens[i+1], "/")
+				if len(parts) > 1 && parts[1] != "" {
+					vt, _ := strconv.Atoi(parts[1])
+					texCoords[i] = uint32(vt - 1)
+				}
+			}
+			model.TriangleTexCoords = append(model.TriangleTexCoords, texCoords)
+			materials.addTriangle(material)
+			groups.addTriangle(group)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := checkWatertight(model.Triangles); err != nil {
+		return nil, err
+	}
+
+	if !hasColors {
+		model.Colors = nil
+	}
+
+	for _, texCoords := range model.TriangleTexCoords {
+		for _, vt := range texCoords {
+			if vt != noTexCoord && int(vt) >= len(model.TexCoords) {
+				return nil, fmt.Errorf("texture coordinate index out of range: %d", vt+1)
+			}
+		}
+	}
+
+	if materials.used {
+		model.Materials = materials.names
+		model.TriangleMaterials = materials.triangles
+	} else if groups.used {
+		model.Materials = groups.names
+		model.TriangleMaterials = groups.triangles
+		model.MaterialsFromGroups = true
+	}
+
+	if len(model.Materials) > math.MaxUint16+1 {
+		return nil, fmt.Errorf("too many materials: %d", len(model.Materials))
+	}
+
+	if duplicated > 0 {
+		model.Warnings = append(model.Warnings, Warning{fmt.Sprintf("mesh has %d duplicated vertices", duplicated), -1})
+	}
+
+	return model, nil
+}
+
+/*
+Signed distance from point p to triangle defined by a, b, and c.
+*/
+func distance(p, a, b, c vec.Vec3) float64 {
+	ba := vec.Sub(b, a)
+	pa := vec.Sub(p, a)
+	cb := vec.Sub(c, b)
+	pb := vec.Sub(p, b)
+	ac := vec.Sub(a, c)
+	pc := vec.Sub(p, c)
+	n := vec.Cross(ba, ac)
+
+	var sign float64
+	t := vec.Dot(n, vec.Sub(p, vec.Scale(vec.Add(vec.Add(b, c), a), 1.0/3.0)))
+
+	if t == 0.0 {
+		return posBigfloat64
+	}
+
+	if t > 0.0 {
+		sign = -1.0
+	} else {
+		sign = 1.0
+	}
+
+	if vec.Sign(vec.Dot(vec.Cross(ba, n), pa))+
+		vec.Sign(vec.Dot(vec.Cross(cb, n), pb))+
+		vec.Sign(vec.Dot(vec.Cross(ac, n), pc)) < 2.0 {
+		return math.Copysign(math.Sqrt(vec.Min3(
+			vec.Dot2(vec.Sub(vec.Scale(ba, vec.Saturate(vec.Dot(ba, pa)/vec.Dot2(ba))), pa)),
+			vec.Dot2(vec.Sub(vec.Scale(cb, vec.Saturate(vec.Dot(cb, pb)/vec.Dot2(cb))), pb)),
+			vec.Dot2(vec.Sub(vec.Scale(ac, vec.Saturate(vec.Dot(ac, pc)/vec.Dot2(ac))), pc)))), sign)
+	}
+
+	return math.Copysign(math.Sqrt((vec.Dot(n, pa) * vec.Dot(n, pa) / vec.Dot2(n))), sign)
+}
+
+/*
+Closest point to p on triangle abc, and its barycentric coordinates.
+From Real-Time Collision Detection, by Christer Ericson.
+*/
+func closestPoint(p, a, b, c vec.Vec3) (vec.Vec3, vec.Vec3) {
+	ab := vec.Sub(b, a)
+	ac := vec.Sub(c, a)
+	ap := vec.Sub(p, a)
+
+	d1 := vec.Dot(ab, ap)
+	d2 := vec.Dot(ac, ap)
+	if d1 <= 0.0 && d2 <= 0.0 {
+		return a, vec.Vec3{1.0, 0.0, 0.0}
+	}
+
+	bp := vec.Sub(p, b)
+	d3 := vec.Dot(ab, bp)
+	d4 := vec.Dot(ac, bp)
+	if d3 >= 0.0 && d4 <= d3 {
+		return b, vec.Vec3{0.0, 1.0, 0.0}
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0.0 && d1 >= 0.0 && d3 <= 0.0 {
+		v := d1 / (d1 - d3)
+		return vec.Add(a, vec.Scale(ab, v)), vec.Vec3{1.0 - v, v, 0.0}
+	}
+
+	cp := vec.Sub(p, c)
+	d5 := vec.Dot(ab, cp)
+	d6 := vec.Dot(ac, cp)
+	if d6 >= 0.0 && d5 <= d6 {
+		return c, vec.Vec3{0.0, 0.0, 1.0}
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0.0 && d2 >= 0.0 && d6 <= 0.0 {
+		w := d2 / (d2 - d6)
+		return vec.Add(a, vec.Scale(ac, w)), vec.Vec3{1.0 - w, 0.0, w}
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0.0 && (d4-d3) >= 0.0 && (d5-d6) >= 0.0 {
+		w := (d4 - d3) / ((d4 - d3) + (d5 - d6))
+		return vec.Add(b, vec.Scale(vec.Sub(c, b), w)), vec.Vec3{0.0, 1.0 - w, w}
+	}
+
+	denom := 1.0 / (va + vb + vc)
+	v := vb * denom
+	w := vc * denom
+
+	return vec.Add(a, vec.Add(vec.Scale(ab, v), vec.Scale(ac, w))), vec.Vec3{1.0 - v - w, v, w}
+}
+
+// Reports whether one of the triangles is within radius of point p
+func (m Mesh) nearTriangles(p vec.Vec3, triangles []int, radius float64) bool {
+	for _, i := range triangles {
+		triangle := m.Triangles[i]
+		q, _ := closestPoint(p, m.Vertices[triangle[0]], m.Vertices[triangle[1]], m.Vertices[triangle[2]])
+
+		if vec.Dot2(vec.Sub(p, q)) <= radius*radius {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Float distance grid, before quantization
+type DistanceField struct {
+	Width, Height, Depth int
+	GridMin, GridMax     vec.Vec3
+	Data                 []float64
+	Triangles            []int   // Closest triangle of each texel, only when asked for
+	MinD, MaxD           float64 // Clamped to the size of the grid
+	Sampling             Sampling
+
+	exactTexels     int // Texels near the surface in hybrid mode, the rest are swept
+	signDifferences int // Texels the flood fill gave the opposite sign from the triangles
+}
+
+// Size of a texel in world units. calculateGridSize gives every axis the same
+// spacing, so any axis will do
+func texelSize(width int, gridMin, gridMax vec.Vec3, sampling Sampling) float64 {
+	if sampling == SamplingCenter {
+		return (gridMax[0] - gridMin[0]) / float64(width)
+	}
+
+	return (gridMax[0] - gridMin[0]) / float64(width-1)
+}
+
+// Box through the first and last samples of a grid, smaller than the grid
+// box with center sampling
+func sampleBounds(width, height, depth int, gridMin, gridMax vec.Vec3, sampling Sampling) (vec.Vec3, vec.Vec3) {
+	if sampling != SamplingCenter {
+		return gridMin, gridMax
+	}
+
+	half := vec.Scale(vec.Mul(vec.Sub(gridMax, gridMin), vec.Vec3{1.0 / float64(width), 1.0 / float64(height), 1.0 / float64(depth)}), 0.5)
+	return vec.Add(gridMin, half), vec.Sub(gridMax, half)
+}
+
+// Scale and bias that take texel coordinates to world positions
+func gridScaleBias(width, height, depth int, gridMin, gridMax vec.Vec3, sampling Sampling) (pointScale, pointBias vec.Vec3) {
+	gridMin, gridMax = sampleBounds(width, height, depth, gridMin, gridMax, sampling)
+
+	pointScale[0] = (gridMax[0] - gridMin[0]) / float64(width-1)
+	pointBias[0] = gridMin[0]
+
+	pointScale[1] = (gridMax[1] - gridMin[1]) / float64(height-1)
+	pointBias[1] = gridMin[1]
+
+	pointScale[2] = (gridMax[2] - gridMin[2]) / float64(depth-1)
+	pointBias[2] = gridMin[2]
+
+	return pointScale, pointBias
+}
+
+// Number of triangles listed in the warning about inverted signs
+const invertedSample = 8
+
+/*
+Logs one warning for all the texels whose sign was inverted, from the count of
+each closest triangle of every worker, listing the first few triangles.
+*/
+func logInvertedSigns(progress Progress, inverted []map[int]int) {
+	count := 0
+	counts := map[int]int{}
+	for _, worker := range inverted {
+		for triangle, n := range worker {
+			counts[triangle] += n
+			count += n
+		}
+	}
+
+	if count == 0 {
+		return
+	}
+
+	triangles := slices.Sorted(maps.Keys(counts))
+	sample := fmt.Sprint(triangles[:min(len(triangles), invertedSample)])
+	if len(triangles) > invertedSample {
+		sample = strings.TrimSuffix(sample, "]") + " ...]"
+	}
+
+	logWarning(progress, -1, "inverted the sign of the distance of %d texels, closest to %d triangles %s", count, len(triangles), sample)
+}
+
+/*
+Goes trough all points of 3D texture and calculates the signed distance to mesh.
+Stops when ctx is done, checking once per row.
+*/
+func calculate(ctx context.Context, settings distanceSettings, mesh Mesh, gridMin, gridMax vec.Vec3, progress Progress) (DistanceField, error) {
+	width := int(settings.width)
+	height := int(settings.height)
+	depth := int(settings.depth)
+
+	logMessage(progress, "Creating triangle lists...")
+	sampleMin, sampleMax := sampleBounds(width, height, depth, gridMin, gridMax, settings.sampling)
+	triangleLists := mesh.createTriangleLists(width, height, depth, sampleMin, sampleMax)
+	cellSize := listCellSize(width, height, depth, sampleMin, sampleMax)
+	search := newTriangleSearch(mesh, settings.convertionOptions&convertionOptionsFloat32 == convertionOptionsFloat32)
+
+	data := make([]float64, width*height*depth)
+
+	var triangles []int
+	if settings.convertionOptions&convertionOptionsTriangles == convertionOptionsTriangles {
+		triangles = make([]int, width*height*depth)
+	}
+
+	// Minimum and maximum distance values (for normalization)
+	minD := negSmallfloat64
+	maxD := posSmallfloat64
+
+	var pointScale, pointBias vec.Vec3
+
+	// Calculate scale and bias for each axis
+	// TODO: mirror modes!
+	/*if settings.convertionOptions&convertionOptionsMirrorX == convertionOptionsMirrorX {
+		if settings.convertionOptions&convertionOptionsMirrorXIncludeCenter == convertionOptionsMirrorXIncludeCenter {
+			// ...
+		} else {
+			// ...
+		}
+
+		if settings.convertionOptions&convertionOptionsMirrorXNegative == convertionOptionsMirrorXNegative {
+			pointScale[0] = -pointScale[0]
+			pointBias[0] = -pointBias[0]
+		}
+	} else {
+		pointScale[0] = (mesh.Max[0] - mesh.Min[0]) / float64(width - 1)
+		pointBias[0] = mesh.Min[0]
+	}*/
+
+	pointScale, pointBias = gridScaleBias(width, height, depth, gridMin, gridMax, settings.sampling)
+
+	maxSize := 0.5 * vec.Length(vec.Sub(gridMax, gridMin))
+
+	// Each worker keeps its own scratch set, range of distances, and the
+	// triangles of the texels whose sign it inverted
+	workers := poolSize(settings.threads, height*depth)
+	visited := make([]*visitedSet, workers)
+	workerMinD := make([]float64, workers)
+	workerMaxD := make([]float64, workers)
+	workerInverted := make([]map[int]int, workers)
+	for i := range workers {
+		visited[i] = newVisitedSet(len(mesh.Triangles))
+		workerMinD[i] = negSmallfloat64
+		workerMaxD[i] = posSmallfloat64
+		workerInverted[i] = map[int]int{}
+	}
+
+	// One tile, and one step, per row
+	stage := startStage(progress, "Calculating distance field", height*depth)
+
+	// Only the texels within a texel diagonal of one of the triangles in their
+	// list are exact in hybrid mode. A triangle that crosses the line between
+	// two texels is in the list of one of them, so the exact texels make a
+	// closed shell around the surface.
+	hybrid := settings.convertionOptions&convertionOptionsHybrid == convertionOptionsHybrid
+	band := math.Sqrt(3.0) * pointScale[0]
+
+	// The surface rasterized into the grid for the flood fill of the exterior,
+	// the texels within half a texel of a triangle in their list. One of the
+	// ends of a line between two texels is that close to any triangle that
+	// crosses it, so the shell is closed.
+	var shell []bool
+	if settings.convertionOptions&convertionOptionsFloodFill == convertionOptionsFloodFill {
+		shell = make([]bool, width*height*depth)
+	}
+
+	// Sub-samples spread evenly over the cube of the size of a texel around
+	// its sample, none without supersampling
+	var offsets []vec.Vec3
+	if n := settings.supersample; n > 1 {
+		for k := range n * n * n {
+			grid := vec.Vec3{float64(k % n), float64(k / n % n), float64(k / (n * n))}
+			offsets = append(offsets, vec.Mul(vec.Sub(vec.Scale(vec.Add(grid, vec.Vec3{0.5, 0.5, 0.5}), 1.0/float64(n)), vec.Vec3{0.5, 0.5, 0.5}), pointScale))
+		}
+	}
+	average := settings.convertionOptions&convertionOptionsAverage == convertionOptionsAverage
+
+	// Distance at the sample of texel x, y, z and its closest triangle,
+	// filtered from the sub-samples when supersampling
+	sample := func(worker int, p vec.Vec3, x, y, z int) (float64, int) {
+		if offsets == nil {
+			return search.closestUsingList(p, width, height, depth, x, y, z, triangleLists, cellSize, visited[worker])
+		}
+
+		sum := 0.0
+		closest := posBigfloat64
+		closestTriangle := -1
+
+		for _, offset := range offsets {
+			d, triangle := search.closestUsingList(vec.Add(p, offset), width, height, depth, x, y, z, triangleLists, cellSize, visited[worker])
+			sum += d
+
+			if math.Abs(d) < math.Abs(closest) {
+				closest = d
+				closestTriangle = triangle
+			}
+		}
+
+		if average {
+			return sum / float64(len(offsets)), closestTriangle
+		}
+
+		return closest, closestTriangle
+	}
+
+	runPool(ctx, settings.threads, height*depth, func(worker, row int) {
+		y := row % height
+		z := row / height
+		previousValue := posBigfloat64
+
+		for x := range width {
+			p := vec.Add(vec.Mul(vec.Vec3{float64(x), float64(y), float64(z)}, pointScale), pointBias)
+
+			if hybrid && !mesh.nearTriangles(p, triangleLists[x+y*width+z*width*height], band) {
+				data[x+y*width+z*width*height] = math.Inf(1)
+				previousValue = posBigfloat64
+				continue
+			}
+
+			if shell != nil {
+				shell[x+y*width+z*width*height] = mesh.nearTriangles(p, triangleLists[x+y*width+z*width*height], 0.5*pointScale[0])
+			}
+
+			d, triangle := sample(worker, p, x, y, z)
+
+			// HACK to fix sign goes here
+
+			// Ignore first value, and leave the signs to the flood fill
+			if shell == nil && previousValue != posBigfloat64 && d != 0.0 && math.Abs(previousValue-d) > math.Sqrt(2.0)*pointScale[0] && previousValue*d < 0.0 {
+				workerInverted[worker][triangle]++
+				d = math.Copysign(d, previousValue)
+			}
+
+			previousValue = d
+			data[x+y*width+z*width*height] = d
+
+			if triangles != nil {
+				triangles[x+y*width+z*width*height] = triangle
+			}
+
+			workerMinD[worker] = min(workerMinD[worker], d)
+			workerMaxD[worker] = max(workerMaxD[worker], d)
+		}
+
+		stage.add(1)
+	})
+
+	if err := ctx.Err(); err != nil {
+		return DistanceField{}, err
+	}
+
+	for i := range workers {
+		minD = min(minD, workerMinD[i])
+		maxD = max(maxD, workerMaxD[i])
+	}
+
+	logInvertedSigns(progress, workerInverted)
+
+	exactTexels := len(data)
+	if hybrid {
+		var err error
+		exactTexels, err = sweepFarField(ctx, data, width, height, depth, pointScale[0], progress)
+		if err != nil {
+			return DistanceField{}, err
+		}
+
+		for _, d := range data {
+			minD = min(minD, d)
+			maxD = max(maxD, d)
+		}
+	}
+
+	signDifferences := 0
+	if shell != nil {
+		logMessage(progress, "Flood filling the exterior...")
+
+		var interior int
+		signDifferences, interior = floodFillSigns(data, width, height, depth, pointScale[0], shell)
+		if interior == 0 {
+			logWarning(progress, -1, "the flood fill found no texels inside the mesh, it may not be closed or may be thinner than a texel")
+		}
+
+		minD = negSmallfloat64
+		maxD = posSmallfloat64
+		for _, d := range data {
+			minD = min(minD, d)
+			maxD = max(maxD, d)
+		}
+	}
+
+	// Clamp the min and max distance values to the size of the grid
+	minD = vec.Max(minD, -maxSize)
+	maxD = vec.Min(maxD, maxSize)
+
+	// Measure distances in texels of the output grid instead of world units
+	if settings.convertionOptions&convertionOptionsTexelUnits == convertionOptionsTexelUnits {
+		scale := 1.0 / texelSize(width, gridMin, gridMax, settings.sampling)
+
+		for i := range data {
+			data[i] *= scale
+		}
+
+		minD *= scale
+		maxD *= scale
+	}
+
+	return DistanceField{
+		Width:     width,
+		Height:    height,
+		Depth:     depth,
+		GridMin:   gridMin,
+		GridMax:   gridMax,
+		Data:      data,
+		Triangles: triangles,
+		MinD:      minD,
+		MaxD:      maxD,
+		Sampling:  settings.sampling,
+
+		exactTexels:     exactTexels,
+		signDifferences: signDifferences,
+	}, nil
+}
+
+/*
+Converts the distances to 8 or 16 bits using the [minD, maxD] range.
+Values outside the range are clamped, and the number of clamped values is returned.
+progress can be nil.
+*/
+func quantize(settings distanceSettings, data []float64, minD, maxD float64, progress Progress) (outputData []byte, clamped int) {
+	// Create buffer of correct type
+	if settings.convertionOptions&convertionOptions16bits == convertionOptions16bits {
+		outputData = make([]byte, len(data)*2)
+	} else {
+		outputData = make([]byte, len(data))
+	}
+
+	// One step per percent
+	step := max(len(data)/100, 1)
+	stage := startStage(progress, "Converting data", len(data))
+
+	for i, v := range data {
+		if i%step == step-1 {
+			stage.add(step)
+		}
+
+		if v < minD || v > maxD {
+			clamped++
+		}
+
+		negative := v < 0.0
+		v = (v - minD) / (maxD - minD) // normalize to [0, 1]
+
+		// Convert to 8 or 16 bits... Rounding up or down depending on the sign of the distance value
+		if settings.convertionOptions&convertionOptions16bits == convertionOptions16bits {
+			var t uint16
+			if negative {
+				t = uint16(vec.Max(0.0, vec.Min(math.Floor(v*65535.0), 65535.0)))
+			} else {
+				t = uint16(vec.Max(0.0, vec.Min(math.Ceil(v*65535.0), 65535.0)))
+			}
+
+			// Convert to little endian
+			outputData[i*2] = byte(t & 0xFF)
+			outputData[i*2+1] = byte((t >> 8) & 0xFF)
+		} else {
+			if negative {
+				outputData[i] = uint8(vec.Max(0.0, vec.Min(math.Floor(v*255), 255.0)))
+			} else {
+				outputData[i] = uint8(vec.Max(0.0, vec.Min(math.Ceil(v*255), 255.0)))
+			}
+		}
+	}
+
+	if rest := len(data) % step; rest > 0 {
+		stage.add(rest)
+	}
+
+	return outputData, clamped
+}
+
+// Interleaves quantized values of size bytes into texels of count channels, missing channels are zero
+func interleaveChannels(channels [][]byte, count, size int) []byte {
+	texels := len(channels[0]) / size
+	out := make([]byte, texels*count*size)
+
+	for c, data := range channels {
+		for i := range texels {
+			copy(out[(i*count+c)*size:(i*count+c+1)*size], data[i*size:(i+1)*size])
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,109 @@
+package sdf
+
+import (
+	"context"
+	"fmt"
+)
+
+func isAdjacent(a, b Triangle) (bool, [2]uint32) {
+	shared := [2]uint32{}
+	count := 0
+
+	for _, va := range a {
+		for _, vb := range b {
+			if va == vb {
+				if count < 2 {
+					shared[count] = va
+				}
+				count++
+			}
+		}
+	}
+
+	return count == 2, shared
+}
+
+func sameWindingOrder(triangleA, triangleB Triangle, shared [2]uint32) bool {
+	for i, a := range triangleA {
+		if a == shared[0] {
+			if triangleA[(i+1)%3] == shared[1] {
+				// other triangle should have shared[1] -> shared[0]
+
+				for j, b := range triangleB {
+					if b == shared[0] {
+						return triangleB[(j+2)%3] == shared[1]
+					}
+				}
+			} else {
+				// other triangle should have shared[1] -> shared[0]
+
+				for j, b := range triangleB {
+					if b == shared[0] {
+						return triangleB[(j+1)%3] == shared[1]
+					}
+				}
+			}
+
+		}
+	}
+
+	// should never be reached I think...
+	return false
+}
+
+/*
+Check if the triangles are pointing in a consistent direction, on a pool of
+threads workers
+*/
+func (mesh *Mesh) fixTriangle(threads int) bool {
+	// One tile per triangle, and its warnings, so they keep the order of the triangles
+	warnings := make([][]Warning, len(mesh.Triangles))
+
+	runPool(context.Background(), threads, len(mesh.Triangles), func(worker, a int) {
+		triangleA := mesh.Triangles[a]
+		adjacentCount := 0
+
+		for b, triangleB := range mesh.Triangles {
+			if a == b {
+				continue
+			}
+
+			adjacent, shared := isAdjacent(triangleA, triangleB)
+			if !adjacent {
+				continue
+			}
+
+			adjacentCount++
+
+			sameWinding := sameWindingOrder(triangleA, triangleB, shared)
+			if !sameWinding {
+
+				warnings[a] = append(warnings[a], Warning{fmt.Sprintf("triangle is inverted compared to its neighbour %d, check your 3D model", a), b})
+
+				/*t := triangleB[0]
+				triangleB[0] = triangleB[1]
+				triangleB[1] = t
+				mesh.Triangles[b] = triangleB
+
+				return false*/
+			}
+		}
+
+		if adjacentCount == 0 {
+			warnings[a] = append(warnings[a], Warning{"disconnected triangle, check your 3D model", a})
+		}
+	})
+
+	for _, w := range warnings {
+		mesh.Warnings = append(mesh.Warnings, w...)
+	}
+
+	return true
+}
+
+// Checks the winding and connectivity of the triangles on a pool of threads
+// workers (GOMAXPROCS when zero), adding a warning for each problem found
+func (mesh *Mesh) FixTriangles(threads int) {
+	for !mesh.fixTriangle(threads) {
+	}
+}
@@ -0,0 +1,1826 @@
+package sdf
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"math"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+/*
+Signed distance from point p to closest point on mesh,
+using brute force method.
+Use to compare with the list method.
+*/
+func (mesh Mesh) distanceBruteForce(p vec.Vec3) float64 {
+	minDistance := math.Inf(1)
+
+	for _, triangle := range mesh.Triangles {
+		v0 := mesh.Vertices[triangle[0]]
+		v1 := mesh.Vertices[triangle[1]]
+		v2 := mesh.Vertices[triangle[2]]
+
+		d := distance(p, v0, v1, v2)
+
+		if d == 0 {
+			return 0.0
+		}
+
+		if math.Abs(d) < math.Abs(minDistance) {
+			minDistance = d
+		}
+	}
+
+	return minDistance
+}
+
+func TestDistance(t *testing.T) {
+	a := vec.Vec3{0.0, 1235.0, -167.0}
+	b := vec.Vec3{0.0, -1432.0, -165.0}
+	c := vec.Vec3{0.0, 0.0, 643.0}
+
+	p := vec.Vec3{-1.0, 0, 0}
+	d0 := distance(p, a, b, c)
+	d1 := distance(p, b, a, c)
+
+	assert.Equal(t, -d0, d1) // distance should be symmetric
+	assert.Equal(t, float64(-1.095445), d0)
+
+	p = vec.Vec3{0.0, 1.0, -1.0}
+	d0 = distance(p, b, a, c)
+	assert.Equal(t, float64(0.0), d0)
+
+	p = vec.Vec3{0.0, 3.0, -1.0}
+	d0 = distance(p, b, a, c)
+	assert.Equal(t, float64(2.0), d0)
+}
+
+// Random triangles, and points around them
+func randomTriangles(n int) (Mesh, []vec.Vec3) {
+	random := rand.New(rand.NewSource(1))
+	point := func(scale float64) vec.Vec3 {
+		return vec.Vec3{(random.Float64()*2.0 - 1.0) * scale, (random.Float64()*2.0 - 1.0) * scale, (random.Float64()*2.0 - 1.0) * scale}
+	}
+
+	var mesh Mesh
+	points := make([]vec.Vec3, n)
+	for i := range n {
+		mesh.Vertices = append(mesh.Vertices, point(1.0), point(1.0), point(1.0))
+		mesh.Triangles = append(mesh.Triangles, Triangle{uint32(3 * i), uint32(3*i + 1), uint32(3*i + 2)})
+		points[i] = point(2.0)
+	}
+
+	return mesh, points
+}
+
+// A closed cube from -1 to 1, with its faces wound outwards
+func testCube(t *testing.T) *Mesh {
+	obj := `v -1 -1 -1
+v 1 -1 -1
+v 1 1 -1
+v -1 1 -1
+v -1 -1 1
+v 1 -1 1
+v 1 1 1
+v -1 1 1
+f 1 3 2
+f 1 4 3
+f 5 6 7
+f 5 7 8
+f 1 2 6
+f 1 6 5
+f 4 8 7
+f 4 7 3
+f 1 5 8
+f 1 8 4
+f 2 3 7
+f 2 7 6
+`
+	mesh, err := ReadOBJ(strings.NewReader(obj), nil)
+	assert.NoError(t, err)
+
+	return mesh
+}
+
+func TestTriangleRecords(t *testing.T) {
+	mesh, points := randomTriangles(1000)
+	records := newTriangleRecords[float64](mesh)
+	records32 := newTriangleRecords[float32](mesh)
+
+	for i, triangle := range mesh.Triangles {
+		p := points[i]
+		d := distance(p, mesh.Vertices[triangle[0]], mesh.Vertices[triangle[1]], mesh.Vertices[triangle[2]])
+
+		assert.InDelta(t, d, records.distance(i, p[0], p[1], p[2]), 1e-9)
+		assert.InDelta(t, d, records32.distance(i, float32(p[0]), float32(p[1]), float32(p[2])), 1e-4)
+	}
+}
+
+func TestDegenerateTriangles(t *testing.T) {
+	// A triangle with its vertices on a line, and one that's a point
+	mesh := Mesh{
+		Vertices:  []vec.Vec3{{0.0, 0.0, 0.0}, {1.0, 0.0, 0.0}, {2.0, 0.0, 0.0}, {0.0, 3.0, 0.0}},
+		Triangles: []Triangle{{0, 1, 2}, {3, 3, 3}},
+	}
+
+	// Also through the lists, from a cell that has none of them
+	triangleLists := mesh.createTriangleLists(4, 4, 4, vec.Vec3{0.0, 0.0, 0.0}, vec.Vec3{3.0, 3.0, 3.0})
+	cellSize := listCellSize(4, 4, 4, vec.Vec3{0.0, 0.0, 0.0}, vec.Vec3{3.0, 3.0, 3.0})
+
+	for _, search := range []triangleSearch{newTriangleRecords[float64](mesh), newTriangleRecords[float32](mesh)} {
+		d, triangle := search.closestUsingList(vec.Vec3{1.5, 0.5, 0.0}, 0, 0, 0, 0, 0, 0, nil, 0.0, nil)
+		assert.Equal(t, 0, triangle)
+		assert.InDelta(t, 0.5, d, 1e-6)
+
+		d, triangle = search.closestUsingList(vec.Vec3{0.0, 2.0, 0.0}, 0, 0, 0, 0, 0, 0, nil, 0.0, nil)
+		assert.Equal(t, 1, triangle)
+		assert.InDelta(t, 1.0, d, 1e-6)
+
+		d, triangle = search.closestUsingList(vec.Vec3{3.0, 3.0, 3.0}, 4, 4, 4, 3, 3, 3, triangleLists, cellSize, newVisitedSet(2))
+		assert.Equal(t, 1, triangle)
+		assert.InDelta(t, math.Sqrt(18.0), d, 1e-6)
+	}
+
+	// A tetrahedron with degenerate faces away from it, the texels next to
+	// them find them first in their lists, and must still get a triangle.
+	// The faces are there twice, wound both ways, so the mesh is watertight.
+	obj := `v 0 1 0
+v 0 -0.5 1
+v -1 -0.5 -0.5
+v 1 -0.5 -0.5
+v 3 0 0
+v 3.5 0 0
+v 4 0 0
+f 1 3 2
+f 1 4 3
+f 2 4 1
+f 3 4 2
+f 5 6 7
+f 5 7 6
+`
+	tetrahedron, err := ReadOBJ(strings.NewReader(obj), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	field, err := calculate(context.Background(), distanceSettings{
+		width:             16,
+		height:            16,
+		depth:             16,
+		convertionOptions: convertionOptionsTriangles,
+	}, *tetrahedron, tetrahedron.Min, tetrahedron.Max, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, triangle := range field.Triangles {
+		assert.True(t, triangle >= 0 && triangle < len(tetrahedron.Triangles))
+	}
+
+	// Everything that looks up the closest triangle of the texels
+	assert.NotPanics(t, func() {
+		closestPoints(*tetrahedron, field)
+		fieldNormals(*tetrahedron, field, true)
+		closestVectors(*tetrahedron, field)
+	})
+}
+
+func BenchmarkDistance(b *testing.B) {
+	mesh, points := randomTriangles(1024)
+	b.ResetTimer()
+
+	for i := range b.N {
+		triangle := mesh.Triangles[i%1024]
+		distance(points[i/1024%1024], mesh.Vertices[triangle[0]], mesh.Vertices[triangle[1]], mesh.Vertices[triangle[2]])
+	}
+}
+
+func BenchmarkTriangleRecords(b *testing.B) {
+	mesh, points := randomTriangles(1024)
+	records := newTriangleRecords[float64](mesh)
+	b.ResetTimer()
+
+	for i := range b.N {
+		p := points[i/1024%1024]
+		records.distance(i%1024, p[0], p[1], p[2])
+	}
+}
+
+func BenchmarkTriangleRecords32(b *testing.B) {
+	mesh, points := randomTriangles(1024)
+	records := newTriangleRecords[float32](mesh)
+	b.ResetTimer()
+
+	for i := range b.N {
+		p := points[i/1024%1024]
+		records.distance(i%1024, float32(p[0]), float32(p[1]), float32(p[2]))
+	}
+}
+
+func TestLoadOBJ(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(mesh.Triangles))
+	assert.Equal(t, 4, len(mesh.Vertices))
+	assert.Equal(t, vec.Vec3{1.0, 1.08866211, 1.15470054}, mesh.Max)
+	assert.Equal(t, vec.Vec3{-1.0, -0.54433105, -0.57735027}, mesh.Min)
+}
+
+func TestCalculate(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	calculate(context.Background(), distanceSettings{
+		width:  8,
+		height: 8,
+		depth:  8,
+	}, *mesh, mesh.Min, mesh.Max, nil)
+}
+
+func TestCalculateProgress(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	settings := distanceSettings{width: 8, height: 8, depth: 8}
+	calls, done, total := 0, 0, 0
+
+	_, err = calculate(context.Background(), settings, *mesh, mesh.Min, mesh.Max, ProgressFunc(func(stage string, d, n int) {
+		assert.True(t, d >= done)
+		calls++
+		done, total = d, n
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 8*8+1, calls)
+	assert.Equal(t, total, done)
+
+	// Cancelled before the first row
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = calculate(ctx, settings, *mesh, mesh.Min, mesh.Max, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The end of a stage is reported once, also when the steps divide it evenly
+	ends := 0
+	quantize(settings, make([]float64, 200), -1.0, 1.0, ProgressFunc(func(stage string, d, n int) {
+		if d == n {
+			ends++
+		}
+	}))
+	assert.Equal(t, 1, ends)
+}
+
+func TestSameWind(t *testing.T) {
+	tA := Triangle{0, 1, 2}
+	tB := Triangle{1, 2, 3}
+	tC := Triangle{3, 2, 1}
+
+	r := sameWindingOrder(tA, tB, [2]uint32{2, 1})
+	assert.False(t, r)
+
+	r = sameWindingOrder(tA, tC, [2]uint32{2, 1})
+	assert.True(t, r)
+}
+
+func TestFixTriangles(t *testing.T) {
+	// A tetrahedron with its last face flipped, and a triangle on its own
+	newMesh := func() *Mesh {
+		return &Mesh{
+			Vertices:  []vec.Vec3{{0.0, 1.0, 0.0}, {0.0, -0.5, 1.0}, {-1.0, -0.5, -0.5}, {1.0, -0.5, -0.5}, {3.0, 0.0, 0.0}, {4.0, 0.0, 0.0}, {3.0, 1.0, 0.0}},
+			Triangles: []Triangle{{0, 2, 1}, {0, 3, 2}, {1, 3, 0}, {2, 1, 3}, {4, 5, 6}},
+		}
+	}
+
+	expected := []Warning{
+		{"triangle is inverted compared to its neighbour 0, check your 3D model", 3},
+		{"triangle is inverted compared to its neighbour 1, check your 3D model", 3},
+		{"triangle is inverted compared to its neighbour 2, check your 3D model", 3},
+		{"triangle is inverted compared to its neighbour 3, check your 3D model", 0},
+		{"triangle is inverted compared to its neighbour 3, check your 3D model", 1},
+		{"triangle is inverted compared to its neighbour 3, check your 3D model", 2},
+		{"disconnected triangle, check your 3D model", 4},
+	}
+
+	// Every triangle is checked, and the warnings are in the same order, whatever the workers
+	for _, threads := range []int{0, 1, 2, 4, 8} {
+		mesh := newMesh()
+		mesh.FixTriangles(threads)
+		assert.Equal(t, expected, mesh.Warnings, "%d threads", threads)
+	}
+}
+
+func TestTriangleList(t *testing.T) {
+	// The skull isn't in the repository
+	if _, err := os.Stat("../../data/skull.obj"); os.IsNotExist(err) {
+		t.Skip("../../data/skull.obj is missing")
+	}
+
+	mesh, err := LoadOBJ("../../data/skull.obj")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	width := 32
+	height := 32
+	depth := 32
+
+	triangleLists := mesh.createTriangleLists(32, 32, 32, mesh.Min, mesh.Max)
+	cellSize := listCellSize(32, 32, 32, mesh.Min, mesh.Max)
+
+	var pointScale, pointBias vec.Vec3
+
+	pointScale[0] = (mesh.Max[0] - mesh.Min[0]) / float64(width-1)
+	pointBias[0] = mesh.Min[0]
+
+	pointScale[1] = (mesh.Max[1] - mesh.Min[1]) / float64(height-1)
+	pointBias[1] = mesh.Min[1]
+
+	pointScale[2] = (mesh.Max[2] - mesh.Min[2]) / float64(depth-1)
+	pointBias[2] = mesh.Min[2]
+
+	search := newTriangleSearch(*mesh, false)
+	visited := newVisitedSet(len(mesh.Triangles))
+
+	for z := range depth {
+		for y := range height {
+			for x := range width {
+				p := vec.Add(vec.Mul(vec.Vec3{float64(x), float64(y), float64(z)}, pointScale), pointBias)
+
+				d0 := mesh.distanceBruteForce(p)
+				d1 := search.distanceUsingList(p, width, height, depth, x, y, z, triangleLists, cellSize, visited)
+
+				assert.InDelta(t, d0, d1, 0.0001)
+			}
+		}
+	}
+}
+
+func TestCalculateGridSize(t *testing.T) {
+	_, h, _, _, _ := calculateGridSize(vec.Vec3{0.0, 0.0, 0.0}, vec.Vec3{2.0, 3.0, 1.0}, 32, SamplingCorner)
+	assert.Equal(t, 32, h)
+
+	// A thin slab keeps the spacing of its biggest side on every axis, and
+	// the half texel border
+	for _, sampling := range []Sampling{SamplingCorner, SamplingCenter} {
+		meshMin, meshMax := vec.Vec3{0.0, 0.0, 0.0}, vec.Vec3{0.05, 1.0, 1.0}
+		w, h, d, gridMin, gridMax := calculateGridSize(meshMin, meshMax, 32, sampling)
+		assert.Equal(t, 32, h)
+		assert.Equal(t, 32, d)
+		assert.Less(t, w, 8)
+
+		texel := texelSize(w, gridMin, gridMax, sampling)
+		assert.InDelta(t, 1.0/30.0, texel, 1e-9)
+
+		pointScale, pointBias := gridScaleBias(w, h, d, gridMin, gridMax, sampling)
+		for i := range 3 {
+			assert.InDelta(t, texel, pointScale[i], 1e-9)
+			assert.LessOrEqual(t, pointBias[i], meshMin[i]-0.5*texel+1e-9)
+			assert.GreaterOrEqual(t, pointBias[i]+pointScale[i]*float64([3]int{w, h, d}[i]-1), meshMax[i]+0.5*texel-1e-9)
+		}
+	}
+}
+
+func TestQuantizeClamp(t *testing.T) {
+	data := []float64{-2.0, -1.0, 0.0, 1.0, 2.0}
+
+	out, clamped := quantize(distanceSettings{}, data, -1.0, 1.0, nil)
+	assert.Equal(t, 2, clamped)
+	assert.Equal(t, []byte{0, 0, 128, 255, 255}, out)
+}
+
+func TestDownsample(t *testing.T) {
+	level := mipLevel{width: 3, height: 2, depth: 2, data: []float64{
+		4.0, -1.0, 3.0,
+		2.0, 5.0, 0.5,
+		3.0, 2.0, 6.0,
+		7.0, 8.0, 9.0,
+	}}
+
+	assert.Equal(t, 2, mipCount(level.width, level.height, level.depth))
+
+	// odd widths fold the last texel into the previous block
+	d := downsample(level)
+	assert.Equal(t, 1, d.width)
+	assert.Equal(t, []float64{0.5}, d.data)
+}
+
+func TestBC4(t *testing.T) {
+	width, height, depth := 6, 5, 2
+	values := make([]int, width*height*depth)
+	for i := range values {
+		values[i] = (i * 37) % 64
+	}
+	values[3] = 255 // clamped far away values go to the limit
+
+	for _, signed := range []bool{false, true} {
+		input := values
+		if signed {
+			input = make([]int, len(values))
+			for i, v := range values {
+				input[i] = min(v-64, 127)
+			}
+		}
+
+		blocks, maxError := encodeBC4(input, width, height, depth, signed, 0)
+		assert.Equal(t, 2*2*depth*8, len(blocks))
+
+		decoded := decodeBC4(blocks, width, height, depth, signed)
+		worst := 0.0
+		for i, v := range decoded {
+			worst = max(worst, math.Abs(v-float64(input[i])))
+		}
+
+		// 64 values with 8 palette entries
+		assert.Equal(t, maxError, worst)
+		assert.LessOrEqual(t, worst, 64.0/14.0+1.0)
+	}
+}
+
+func TestADF(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	rootMin := vec.Vec3{-1.5, -1.5, -1.5}
+	a, _, err := buildADF(context.Background(), *mesh, rootMin, 3.0, 3, 0.01, false, 0, nil)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	assert.NoError(t, a.Write(&buffer))
+	assert.Equal(t, a.byteSize(), buffer.Len())
+
+	b, err := ReadADF(&buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, a.nodes, b.nodes)
+
+	// leaf corners are exact, the root corners are corners of some leaf,
+	// signs can differ when two triangles are at the same distance
+	for i := range 8 {
+		p := vec.Add(rootMin, vec.Scale(adfOffset(i), 3.0))
+		assert.InDelta(t, math.Abs(mesh.distanceBruteForce(p)), math.Abs(b.Sample(p)), 0.0001)
+	}
+
+	p := vec.Vec3{0.1, 0.2, 0.3}
+	assert.Equal(t, a.Sample(p), b.Sample(p))
+
+	// Corrupt files are errors
+	var valid bytes.Buffer
+	assert.NoError(t, a.Write(&valid))
+	file := valid.Bytes()
+
+	_, err = ReadADF(bytes.NewReader(file[:len(file)-1]))
+	assert.Error(t, err)
+
+	huge := bytes.Clone(file)
+	binary.LittleEndian.PutUint32(huge[8:], 0xFFFFFFFF)
+	_, err = ReadADF(bytes.NewReader(huge))
+	assert.Error(t, err)
+
+	loop := bytes.Clone(file)
+	binary.LittleEndian.PutUint32(loop[28:], 0)
+	_, err = ReadADF(bytes.NewReader(loop))
+	assert.Error(t, err)
+
+	leaf := bytes.Clone(file)
+	binary.LittleEndian.PutUint32(leaf[28:], adfLeaf|uint32(len(a.corners)/8))
+	_, err = ReadADF(bytes.NewReader(leaf))
+	assert.Error(t, err)
+
+	// The range of an octree is the one of its samples, so it can be shared
+	// with grids
+	options := DefaultOptions()
+	options.Resolution = 16
+	options.ADF = true
+	octree, err := Bake(context.Background(), mesh, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	minD, maxD := float64(slices.Min(octree.adf.corners)), float64(slices.Max(octree.adf.corners))
+	assert.Negative(t, minD)
+	assert.Positive(t, maxD)
+	assert.Equal(t, []float64{minD, maxD}, []float64{octree.Field.MinD, octree.Field.MaxD})
+	assert.Equal(t, []float64{minD, maxD}, []float64{octree.MinD, octree.MaxD})
+
+	options.ADF = false
+	grid, err := Bake(context.Background(), mesh, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sharedMin, sharedMax := SharedRange([]*Result{octree, grid})
+	assert.Equal(t, min(minD, grid.Field.MinD), sharedMin)
+	assert.Equal(t, max(maxD, grid.Field.MaxD), sharedMax)
+}
+
+func TestFloat16(t *testing.T) {
+	assert.Equal(t, uint16(0x3C00), float16(1.0))
+	assert.Equal(t, uint16(0xC000), float16(-2.0))
+	assert.Equal(t, uint16(0x2E66), float16(0.1))
+	assert.Equal(t, uint16(0x7BFF), float16(65504.0))
+	assert.Equal(t, uint16(0x7C00), float16(1e6))
+	assert.Equal(t, uint16(0x0001), float16(6e-8))
+	assert.Equal(t, uint16(0x0000), float16(1e-10))
+}
+
+// Converts an IEEE 754 half precision float to a float64
+func halfFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+
+	exp := int(h>>10) & 0x1F
+	mantissa := float64(h & 0x3FF)
+	if exp == 0 {
+		return sign * math.Ldexp(mantissa, -24)
+	}
+
+	return sign * math.Ldexp(1.0+mantissa/1024.0, exp-15)
+}
+
+// Closest point of the cube of testCube to p, false when there's more than one
+func cubeClosest(p vec.Vec3) (vec.Vec3, bool) {
+	if math.Abs(p[0]) > 1.0 || math.Abs(p[1]) > 1.0 || math.Abs(p[2]) > 1.0 {
+		return vec.Vec3{vec.Clamp(p[0], -1.0, 1.0), vec.Clamp(p[1], -1.0, 1.0), vec.Clamp(p[2], -1.0, 1.0)}, true
+	}
+
+	// Inside, on the nearest face
+	axis := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(p[i]) > math.Abs(p[axis]) {
+			axis = i
+		}
+	}
+	for i := range 3 {
+		if i != axis && math.Abs(math.Abs(p[i])-math.Abs(p[axis])) < 1e-9 {
+			return vec.Vec3{}, false
+		}
+	}
+
+	q := p
+	q[axis] = signNotZero(p[axis])
+
+	return q, true
+}
+
+func TestVectors(t *testing.T) {
+	mesh := testCube(t)
+	if mesh == nil {
+		return
+	}
+
+	for _, test := range []struct {
+		vectors Vectors
+		bits    Type
+	}{{VectorsHalf, Type8}, {VectorsSnorm, Type8}, {VectorsSnorm, Type16}} {
+		options := DefaultOptions()
+		options.Resolution = 16
+		options.Type = test.bits
+		options.Vectors = test.vectors
+		options.VectorSign = true
+
+		r, err := Bake(context.Background(), mesh, options)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var volume *Volume
+		for i := range r.Volumes {
+			if r.Volumes[i].Name == "vectors" {
+				volume = &r.Volumes[i]
+			}
+		}
+		if !assert.NotNil(t, volume) {
+			return
+		}
+
+		// Reads channel c of texel i
+		field := r.Field
+		scale := r.Metadata["vectors_scale"].(float64)
+		channel := func(i, c int) float64 {
+			switch {
+			case test.vectors == VectorsHalf:
+				return halfFloat(binary.LittleEndian.Uint16(volume.Data[(i*4+c)*2:]))
+			case test.bits == Type16:
+				return float64(int16(binary.LittleEndian.Uint16(volume.Data[(i*4+c)*2:]))) / 32767.0
+			}
+			return float64(int8(volume.Data[i*4+c])) / 127.0
+		}
+
+		tolerance := 2e-3
+		if test.vectors == VectorsSnorm {
+			tolerance = scale / float64(int(1)<<(int(test.bits)-1)-1)
+		}
+
+		exact := closestVectors(*mesh, field)
+		checked := 0
+
+		for z := range field.Depth {
+			for y := range field.Height {
+				for x := range field.Width {
+					i := x + y*field.Width + z*field.Width*field.Height
+					p := field.position(x, y, z)
+
+					// The vector reaches the surface, whatever the triangle
+					assert.InDelta(t, math.Abs(field.Data[i]), vec.Length(exact[i]), 1e-9)
+					assert.Equal(t, signNotZero(field.Data[i]), channel(i, 3))
+
+					q, ok := cubeClosest(p)
+					if !ok {
+						continue
+					}
+
+					v := vec.Sub(q, p)
+					for c := range 3 {
+						assert.InDelta(t, v[c], exact[i][c], 1e-9, "texel %v", p)
+
+						decoded := channel(i, c)
+						if test.vectors == VectorsSnorm {
+							decoded *= scale
+						}
+						assert.InDelta(t, v[c], decoded, tolerance, "%s %d texel %v", test.vectors, test.bits, p)
+					}
+					checked++
+				}
+			}
+		}
+
+		assert.Greater(t, checked, len(field.Data)/2)
+	}
+}
+
+func TestTriangleVolumes(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	options := DefaultOptions()
+	options.Resolution = 16
+	options.Triangles = true
+
+	r, err := Bake(context.Background(), mesh, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	volumes := map[string][]byte{}
+	for _, volume := range r.Volumes {
+		volumes[volume.Name] = volume.Data
+	}
+
+	field := r.Field
+	if !assert.Len(t, volumes["triangles"], len(field.Data)*4) || !assert.Len(t, volumes["barycentrics"], len(field.Data)*12) {
+		return
+	}
+
+	search := newTriangleRecords[float64](*mesh)
+	matches := 0
+
+	for z := range field.Depth {
+		for y := range field.Height {
+			for x := range field.Width {
+				i := x + y*field.Width + z*field.Width*field.Height
+				p := field.position(x, y, z)
+
+				// The closest triangle of an exhaustive search, or one just as close
+				triangle := int(binary.LittleEndian.Uint32(volumes["triangles"][i*4:]))
+				d, closest := search.closestUsingList(p, 0, 0, 0, 0, 0, 0, nil, 0.0, nil)
+				if !assert.True(t, triangle >= 0 && triangle < len(mesh.Triangles)) {
+					return
+				}
+				if triangle == closest {
+					matches++
+				} else {
+					assert.InDelta(t, math.Abs(d), math.Abs(search.distance(triangle, p[0], p[1], p[2])), 1e-9, "texel %v", p)
+				}
+
+				// Weights of the closest point on that triangle
+				var b vec.Vec3
+				for c := range 3 {
+					b[c] = float64(math.Float32frombits(binary.LittleEndian.Uint32(volumes["barycentrics"][i*12+c*4:])))
+					assert.True(t, b[c] >= 0.0 && b[c] <= 1.0)
+				}
+				assert.InDelta(t, 1.0, b[0]+b[1]+b[2], 1e-6)
+
+				vertices := mesh.Triangles[triangle]
+				q := vec.Add(vec.Add(vec.Scale(mesh.Vertices[vertices[0]], b[0]), vec.Scale(mesh.Vertices[vertices[1]], b[1])), vec.Scale(mesh.Vertices[vertices[2]], b[2]))
+				expected, _ := closestPoint(p, mesh.Vertices[vertices[0]], mesh.Vertices[vertices[1]], mesh.Vertices[vertices[2]])
+				for c := range 3 {
+					assert.InDelta(t, expected[c], q[c], 1e-6)
+				}
+				assert.InDelta(t, math.Abs(d), vec.Length(vec.Sub(q, p)), 1e-6)
+			}
+		}
+	}
+
+	assert.Greater(t, matches, len(field.Data)/2)
+}
+
+func TestLoadOBJMaterials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "materials.obj")
+	obj := `v 0 1 0
+v 0 -0.5 1
+v -1 -0.5 -0.5
+v 1 -0.5 -0.5
+g body
+usemtl red
+f 1 3 2
+f 1 4 3
+usemtl blue
+f 2 4 1
+usemtl red
+f 3 4 2
+`
+	assert.NoError(t, os.WriteFile(path, []byte(obj), 0644))
+
+	mesh, err := LoadOBJ(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"red", "blue"}, mesh.Materials)
+	assert.Equal(t, []uint16{0, 0, 1, 0}, mesh.TriangleMaterials)
+	assert.False(t, mesh.MaterialsFromGroups)
+}
+
+func TestTextureColors(t *testing.T) {
+	dir := t.TempDir()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 0, 255, 255})
+	file, err := os.Create(filepath.Join(dir, "texture.png"))
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(file, img))
+	file.Close()
+
+	mtl := "newmtl paint\nKd 0 1 0\nmap_Kd texture.png\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "paint.mtl"), []byte(mtl), 0644))
+
+	// every vertex uses the center of the left texel
+	obj := `mtllib paint.mtl
+v 0 1 0
+v 0 -0.5 1
+v -1 -0.5 -0.5
+v 1 -0.5 -0.5
+vt 0.25 0.5
+usemtl paint
+f 1/1 3/1 2/1
+f 1/1 4/1 3/1
+f 2/1 4/1 1/1
+f 3/1 4/1 2/1
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "paint.obj"), []byte(obj), 0644))
+
+	mesh, err := LoadOBJ(filepath.Join(dir, "paint.obj"))
+	assert.NoError(t, err)
+
+	field, err := calculate(context.Background(), distanceSettings{
+		width:             8,
+		height:            8,
+		depth:             8,
+		convertionOptions: convertionOptionsTriangles,
+	}, *mesh, mesh.Min, mesh.Max, nil)
+	assert.NoError(t, err)
+
+	colors, err := textureColors(*mesh, field, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{255, 0, 0, 255}, colors[:4])
+	assert.Equal(t, []byte{255, 0, 0, 255}, colors[len(colors)-4:])
+}
+
+func TestLoadPLY(t *testing.T) {
+	vertices := []vec.Vec3{{0, 1, 0}, {0, -0.5, 1}, {-1, -0.5, -0.5}, {1, -0.5, -0.5}}
+	colors := [][3]uint8{{255, 0, 0}, {0, 255, 0}, {0, 0, 255}, {255, 51, 102}}
+	triangles := []Triangle{{0, 2, 1}, {0, 3, 2}, {1, 3, 0}, {2, 3, 1}}
+
+	header := func(format string) string {
+		return "ply\nformat " + format + " 1.0\ncomment tetrahedron with vertex colors\n" +
+			"element vertex 4\nproperty float x\nproperty float y\nproperty float z\n" +
+			"property uchar red\nproperty uchar green\nproperty uchar blue\n" +
+			"element face 4\nproperty list uchar int vertex_indices\nend_header\n"
+	}
+
+	ascii := header("ascii") + `0 1 0 255 0 0
+0 -0.5 1 0 255 0
+-1 -0.5 -0.5 0 0 255
+1 -0.5 -0.5 255 51 102
+3 0 2 1
+3 0 3 2
+3 1 3 0
+3 2 3 1
+`
+
+	var little bytes.Buffer
+	little.WriteString(header("binary_little_endian"))
+	for i, v := range vertices {
+		for _, c := range v {
+			assert.NoError(t, binary.Write(&little, binary.LittleEndian, float32(c)))
+		}
+		little.Write(colors[i][:])
+	}
+	for _, triangle := range triangles {
+		little.WriteByte(3)
+		for _, index := range triangle {
+			assert.NoError(t, binary.Write(&little, binary.LittleEndian, int32(index)))
+		}
+	}
+
+	for _, file := range []struct {
+		format string
+		data   []byte
+	}{
+		{"ascii", []byte(ascii)},
+		{"binary_little_endian", little.Bytes()},
+	} {
+		path := filepath.Join(t.TempDir(), "colors.ply")
+		assert.NoError(t, os.WriteFile(path, file.data, 0644))
+
+		mesh, err := LoadMesh(path)
+		if !assert.NoError(t, err, file.format) {
+			continue
+		}
+
+		assert.Equal(t, vertices, mesh.Vertices, file.format)
+		assert.Equal(t, triangles, mesh.Triangles, file.format)
+		assert.Equal(t, vec.Vec3{-1, -0.5, -0.5}, mesh.Min, file.format)
+		assert.Equal(t, vec.Vec3{1, 1, 1}, mesh.Max, file.format)
+
+		if assert.Equal(t, len(vertices), len(mesh.Colors), file.format) {
+			for i, c := range colors {
+				for j := range 3 {
+					assert.InDelta(t, float64(c[j])/255.0, mesh.Colors[i][j], 1e-12, "%s vertex %d", file.format, i)
+				}
+			}
+		}
+
+		field, err := calculate(context.Background(), distanceSettings{
+			width:             8,
+			height:            8,
+			depth:             8,
+			convertionOptions: convertionOptionsTriangles,
+		}, *mesh, mesh.Min, mesh.Max, nil)
+		assert.NoError(t, err)
+
+		volume, err := vertexColors(*mesh, field)
+		assert.NoError(t, err)
+		assert.Equal(t, len(field.Data)*4, len(volume), file.format)
+	}
+}
+
+func TestCurvature(t *testing.T) {
+	const size = 32
+	const radius = 10.0
+
+	field := DistanceField{Width: size, Height: size, Depth: size, Data: make([]float64, size*size*size)}
+	for z := range size {
+		for y := range size {
+			for x := range size {
+				p := vec.Vec3{float64(x) - size/2, float64(y) - size/2, float64(z) - size/2}
+				field.Data[x+y*size+z*size*size] = vec.Length(p) - radius
+			}
+		}
+	}
+
+	mean, gaussian := field.curvature(size/2+radius, size/2, size/2, 1.0)
+	assert.InDelta(t, 1.0/radius, mean, 0.01)
+	assert.InDelta(t, 1.0/(radius*radius), gaussian, 0.001)
+}
+
+// Field of a box in texel coordinates, scaled to distance units, negative inside
+func boxField(size int, center, half vec.Vec3, scale float64) DistanceField {
+	field := DistanceField{Width: size, Height: size, Depth: size, Data: make([]float64, size*size*size)}
+	for z := range size {
+		for y := range size {
+			for x := range size {
+				p := vec.Vec3{float64(x), float64(y), float64(z)}
+
+				var q, outside vec.Vec3
+				for i := range 3 {
+					q[i] = math.Abs(p[i]-center[i]) - half[i]
+					outside[i] = max(q[i], 0.0)
+				}
+
+				inside := min(max(q[0], q[1], q[2]), 0.0)
+				field.Data[x+y*size+z*size*size] = (vec.Length(outside) + inside) * scale
+			}
+		}
+	}
+
+	return field
+}
+
+func TestOcclusion(t *testing.T) {
+	const size = 32
+	const texel = 0.5 // Distance units per texel
+	const band = 4.0
+	index := func(x, y, z int) int { return x + y*size + z*size*size }
+
+	// A solid box 6 texels wide, from x = 17 to 23
+	solid := boxField(size, vec.Vec3{20, 16, 16}, vec.Vec3{3, 3, 3}, texel)
+	occlusion, thickness, maxThickness := solid.occlusionAndThickness(texel, band, 0)
+
+	// A texel one texel off a face sees nothing but open space along the gradient,
+	// and the other side of the box is 6 texels away going inwards
+	near := index(16, 16, 16)
+	assert.InDelta(t, 1.0, occlusion[near], 1e-9)
+	assert.InDelta(t, 6.0, thickness[near], 0.25)
+
+	// Texels by the corners go through the box diagonally
+	assert.GreaterOrEqual(t, maxThickness, thickness[near])
+	assert.LessOrEqual(t, maxThickness, 6.0*math.Sqrt(3.0)+0.25)
+
+	// Far away texels are outside of the band
+	far := index(2, 2, 2)
+	assert.Equal(t, 1.0, occlusion[far])
+	assert.Equal(t, 0.0, thickness[far])
+
+	// The inside of a closed box, a room 2.5 texels wide from x = 15 to 17.5.
+	// Every sample along the gradient is closer to the walls than the texel,
+	// or already in the far wall
+	room := boxField(size, vec.Vec3{16.25, 16, 16}, vec.Vec3{1.25, 4, 4}, -texel)
+	occlusion, _, _ = room.occlusionAndThickness(texel, band, 0)
+	assert.InDelta(t, 0.0, occlusion[index(16, 16, 16)], 1e-9)
+}
+
+// Inverse of octEncode
+func octDecode(x, y float64) vec.Vec3 {
+	n := vec.Vec3{x, y, 1.0 - math.Abs(x) - math.Abs(y)}
+	if n[2] < 0.0 {
+		n[0], n[1] = (1.0-math.Abs(y))*signNotZero(x), (1.0-math.Abs(x))*signNotZero(y)
+	}
+
+	return vec.Normalize(n)
+}
+
+func TestNormals(t *testing.T) {
+	mesh := testCube(t)
+	if mesh == nil {
+		return
+	}
+
+	field, err := calculate(context.Background(), distanceSettings{
+		width:             16,
+		height:            16,
+		depth:             16,
+		convertionOptions: convertionOptionsTriangles,
+	}, *mesh, vec.Vec3{-2.0, -2.0, -2.0}, vec.Vec3{2.0, 2.0, 2.0}, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, analytic := range []bool{true, false} {
+		normals := fieldNormals(*mesh, field, analytic)
+		faces := 0
+
+		for z := range field.Depth {
+			for y := range field.Height {
+				for x := range field.Width {
+					n := normals[x+y*field.Width+z*field.Width*field.Height]
+					if vec.Dot2(n) > 0.0 {
+						assert.InDelta(t, 1.0, vec.Length(n), 1e-9)
+					}
+
+					// Outside of the cube, in front of the middle of a face
+					p := field.position(x, y, z)
+					for axis := range 3 {
+						side := vec.Vec3{}
+						side[axis] = signNotZero(p[axis])
+						if math.Abs(p[axis]) < 1.2 || math.Abs(p[(axis+1)%3]) > 0.5 || math.Abs(p[(axis+2)%3]) > 0.5 {
+							continue
+						}
+
+						assert.Greater(t, vec.Dot(n, side), 0.9, "analytic %v at %v", analytic, p)
+						faces++
+					}
+				}
+			}
+		}
+
+		assert.Positive(t, faces)
+	}
+
+	// Octahedral round trip, exact before quantization and close after it
+	random := rand.New(rand.NewSource(1))
+	normals := []vec.Vec3{{1.0, 0.0, 0.0}, {-1.0, 0.0, 0.0}, {0.0, 1.0, 0.0}, {0.0, -1.0, 0.0}, {0.0, 0.0, 1.0}, {0.0, 0.0, -1.0}}
+	for range 256 {
+		normals = append(normals, vec.Normalize(vec.Vec3{random.NormFloat64(), random.NormFloat64(), random.NormFloat64()}))
+	}
+
+	for _, n := range normals {
+		x, y := octEncode(n)
+		assert.InDelta(t, 1.0, vec.Dot(n, octDecode(x, y)), 1e-9, "%v", n)
+	}
+
+	for _, bits := range []int{8, 16} {
+		size := bits / 8
+		scale := float64(int(1)<<bits - 1)
+		packed := packNormalsOct(normals, bits)
+		assert.Equal(t, len(normals)*2*size, len(packed))
+
+		unorm := func(b []byte) float64 {
+			if bits == 16 {
+				return float64(binary.LittleEndian.Uint16(b)) / scale
+			}
+			return float64(b[0]) / scale
+		}
+
+		for i, n := range normals {
+			x := unorm(packed[i*2*size:])*2.0 - 1.0
+			y := unorm(packed[i*2*size+size:])*2.0 - 1.0
+			assert.Greater(t, vec.Dot(n, octDecode(x, y)), math.Cos(4.0/scale), "%d bits %v", bits, n)
+		}
+	}
+}
+
+func TestInterleaveChannels(t *testing.T) {
+	r := []byte{1, 2, 3, 4}
+	g := []byte{5, 6, 7, 8}
+
+	assert.Equal(t, []byte{1, 2, 5, 6, 3, 4, 7, 8}, interleaveChannels([][]byte{r, g}, 2, 2))
+	assert.Equal(t, []byte{1, 5, 0, 0, 2, 6, 0, 0, 3, 7, 0, 0, 4, 8, 0, 0}, interleaveChannels([][]byte{r, g}, 4, 1))
+}
+
+// Types of the arguments of the constructor call of a snippet, and its name
+func snippetCall(snippet string) (string, []string) {
+	open := strings.Index(snippet, "(")
+	name := snippet[:open]
+	body := strings.TrimSuffix(strings.TrimSpace(snippet[open+1:]), ");")
+
+	var types []string
+	depth, start := 0, 0
+	for i := 0; i <= len(body); i++ {
+		if i < len(body) && body[i] == '(' {
+			depth++
+		} else if i < len(body) && body[i] == ')' {
+			depth--
+		} else if i == len(body) || body[i] == ',' && depth == 0 {
+			arg := strings.TrimSpace(body[start:i])
+			if call := strings.Index(arg, "("); call >= 0 {
+				types = append(types, arg[:call])
+			} else {
+				types = append(types, "float")
+			}
+			start = i + 1
+		}
+	}
+
+	return name, types
+}
+
+func TestSnippet(t *testing.T) {
+	source, err := os.ReadFile("../../unpack.glsl")
+	assert.NoError(t, err)
+
+	// Field types of every struct of the shader
+	structs := map[string][]string{}
+	for _, m := range regexp.MustCompile(`struct (\w+) \{([^}]*)\};`).FindAllStringSubmatch(string(source), -1) {
+		for _, field := range regexp.MustCompile(`(\w+) \w+;`).FindAllStringSubmatch(m[2], -1) {
+			structs[m[1]] = append(structs[m[1]], field[1])
+		}
+	}
+
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.BoundsMin, options.BoundsMax = UnionBounds([]*Mesh{mesh})
+
+	var results []*Result
+	for range 2 {
+		r, err := Bake(context.Background(), mesh, options)
+		assert.NoError(t, err)
+		results = append(results, r)
+	}
+
+	packed, err := PackChannels(results)
+	assert.NoError(t, err)
+
+	for _, r := range []*Result{results[0], packed} {
+		name, types := snippetCall(r.Snippet())
+		assert.Contains(t, structs, name)
+		assert.Equal(t, structs[name], types, name)
+	}
+
+	name, _ := snippetCall(packed.Snippet())
+	assert.Equal(t, "modelChannels", name)
+}
+
+func TestPackBoxes(t *testing.T) {
+	boxes := []atlasBox{
+		{width: 10, height: 12, depth: 8},
+		{width: 6, height: 6, depth: 6},
+		{width: 18, height: 4, depth: 10},
+		{width: 3, height: 9, depth: 2},
+		{width: 7, height: 7, depth: 7},
+	}
+
+	width, height, depth := packBoxes(boxes)
+
+	for i, a := range boxes {
+		assert.True(t, a.x >= 0 && a.y >= 0 && a.z >= 0)
+		assert.True(t, a.x+a.width <= width && a.y+a.height <= height && a.z+a.depth <= depth)
+
+		for _, b := range boxes[i+1:] {
+			overlap := a.x < b.x+b.width && b.x < a.x+a.width &&
+				a.y < b.y+b.height && b.y < a.y+a.height &&
+				a.z < b.z+b.depth && b.z < a.z+a.depth
+			assert.False(t, overlap)
+		}
+	}
+}
+
+func TestPackAtlas(t *testing.T) {
+	tetrahedron, err := LoadOBJ("../../tetrahedron.obj")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cube := testCube(t)
+	if cube == nil {
+		return
+	}
+
+	options := DefaultOptions()
+	options.Type = Type16
+
+	var results []*Result
+	for i, mesh := range []*Mesh{tetrahedron, cube} {
+		options.Resolution = 16 + 4*i
+		r, err := Bake(context.Background(), mesh, options)
+		if !assert.NoError(t, err) {
+			return
+		}
+		results = append(results, r)
+	}
+
+	const padding = 2
+	atlas, err := PackAtlas(results, padding)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	width, height, depth := atlas.Texture.Width, atlas.Texture.Height, atlas.Texture.Depth
+	assert.Equal(t, []any{width, height, depth}, []any{atlas.Metadata["texture_width"], atlas.Metadata["texture_height"], atlas.Metadata["texture_depth"]})
+	assert.Equal(t, padding, atlas.Metadata["atlas_padding"])
+	assert.Len(t, atlas.Texture.Data, width*height*depth*2)
+
+	assets := atlas.Metadata["assets"].([]map[string]any)
+	if !assert.Len(t, assets, len(results)) {
+		return
+	}
+
+	texel := func(data []byte, i int) uint16 {
+		return binary.LittleEndian.Uint16(data[i*2:])
+	}
+
+	used := make([]bool, width*height*depth)
+
+	for i, r := range results {
+		asset := assets[i]
+		offset := asset["atlas_offset"].([]int)
+		size := asset["atlas_size"].([]int)
+		field := r.Field
+		assert.Equal(t, []int{field.Width, field.Height, field.Depth}, size)
+
+		// Padding included
+		for c, n := range []int{width, height, depth} {
+			assert.True(t, offset[c] >= padding && offset[c]+size[c]+padding <= n)
+			assert.InDelta(t, float64(offset[c])/float64(n), asset["atlas_uvw_min"].(vec.Vec3)[c], 1e-12)
+			assert.InDelta(t, float64(offset[c]+size[c])/float64(n), asset["atlas_uvw_max"].(vec.Vec3)[c], 1e-12)
+		}
+
+		assert.Equal(t, r.MinD, asset["distance_min"])
+		assert.Equal(t, r.MaxD, asset["distance_max"])
+		assert.Equal(t, field.GridMin, asset["grid_bounding_box_min"])
+		assert.Equal(t, field.GridMax, asset["grid_bounding_box_max"])
+
+		// The volume, and its edges repeated in the padding
+		for z := -padding; z < field.Depth+padding; z++ {
+			for y := -padding; y < field.Height+padding; y++ {
+				for x := -padding; x < field.Width+padding; x++ {
+					dst := (offset[0] + x) + (offset[1]+y)*width + (offset[2]+z)*width*height
+					src := vec.Clamp(x, 0, field.Width-1) + vec.Clamp(y, 0, field.Height-1)*field.Width + vec.Clamp(z, 0, field.Depth-1)*field.Width*field.Height
+
+					assert.False(t, used[dst], "asset %d overlaps", i)
+					used[dst] = true
+					assert.Equal(t, texel(r.Texture.Data, src), texel(atlas.Texture.Data, dst), "asset %d texel %d %d %d", i, x, y, z)
+				}
+			}
+		}
+	}
+
+	// The rest is as far as possible
+	for i, u := range used {
+		if !u {
+			assert.Equal(t, uint16(0xFFFF), texel(atlas.Texture.Data, i))
+		}
+	}
+
+	_, err = PackAtlas(results, -1)
+	assert.Error(t, err)
+}
+
+func TestBake(t *testing.T) {
+	file, err := os.Open("../../tetrahedron.obj")
+	assert.NoError(t, err)
+	defer file.Close()
+
+	mesh, err := ReadOBJ(file, nil)
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.Resolution = 16
+	options.Format = FormatDDS
+	options.Occlusion = true
+
+	result, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	field := result.Field
+	assert.Equal(t, field.Width*field.Height*field.Depth, len(field.Data))
+	assert.Equal(t, len(field.Data), len(result.Texture.Data))
+	assert.Equal(t, field.MinD, result.MinD)
+	assert.Equal(t, field.MaxD, result.MaxD)
+	assert.Equal(t, "u8", result.Metadata["texture_format"])
+	assert.Equal(t, 1, len(result.Volumes))
+	assert.Equal(t, "occlusion", result.Volumes[0].Name)
+
+	var out bytes.Buffer
+	assert.NoError(t, result.Texture.Write(&out, FormatDDS))
+	assert.Equal(t, []byte("DDS "), out.Bytes()[:4])
+	assert.Equal(t, len(result.Texture.Data)+128, out.Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Bake(ctx, mesh, options)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	options.Resolution = 8
+	_, err = Bake(context.Background(), mesh, options)
+	assert.Error(t, err)
+
+	// Shared bounds must be valid on every axis, not only X
+	options = DefaultOptions()
+	options.BoundsMin = vec.Vec3{-2.0, 2.0, -2.0}
+	options.BoundsMax = vec.Vec3{2.0, -2.0, 2.0}
+	assert.Error(t, options.Validate())
+
+	options.BoundsMin[1] = -2.0
+	options.BoundsMax[2] = -2.0
+	assert.Error(t, options.Validate())
+
+	options.BoundsMax[1], options.BoundsMax[2] = 2.0, 2.0
+	result, err = Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+	assert.True(t, result.Field.GridMin[1] < -2.0 && result.Field.GridMax[2] > 2.0)
+}
+
+func TestCompressionError(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.Resolution = 16
+	options.Compress = CompressBC4
+
+	world, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	options.Units = UnitsTexel
+	texel, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	// The same blocks, the error is in world units either way
+	assert.Equal(t, world.Texture.Data, texel.Texture.Data)
+
+	e := world.Metadata["compression_max_error"].(float64)
+	assert.Positive(t, e)
+	assert.InDelta(t, e, texel.Metadata["compression_max_error"].(float64), 1e-9)
+
+	// And it's the largest difference between the decoded blocks and the distances
+	field := world.Field
+	decoded := decodeBC4(world.Texture.Data, field.Width, field.Height, field.Depth, false)
+	largest := 0.0
+	for i, v := range decoded {
+		largest = max(largest, math.Abs(v/255.0*(world.MaxD-world.MinD)+world.MinD-field.Data[i]))
+	}
+	assert.InDelta(t, largest, e, 1e-9)
+}
+
+func TestKTX2(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	for _, compress := range []Compression{CompressNone, CompressBC4} {
+		options := DefaultOptions()
+		options.Resolution = 16
+		options.Format = FormatKTX2
+		options.Mips = true
+		options.Compress = compress
+
+		result, err := Bake(context.Background(), mesh, options)
+		assert.NoError(t, err)
+
+		var out bytes.Buffer
+		assert.NoError(t, result.Texture.Write(&out, FormatKTX2))
+		file := out.Bytes()
+
+		var header KTX2Header
+		reader := bytes.NewReader(file)
+		assert.NoError(t, binary.Read(reader, binary.LittleEndian, &header))
+		assert.Equal(t, KTX2_IDENTIFIER, header.Identifier)
+		assert.Equal(t, uint32(result.Texture.Width), header.PixelWidth)
+		assert.Equal(t, uint32(result.Texture.Depth), header.PixelDepth)
+		assert.Equal(t, uint32(result.Texture.Mips), header.LevelCount)
+		assert.Equal(t, uint32(1), header.FaceCount)
+
+		levels := make([]KTX2Level, header.LevelCount)
+		assert.NoError(t, binary.Read(reader, binary.LittleEndian, levels))
+		assert.Equal(t, header.DFDByteLength, binary.LittleEndian.Uint32(file[header.DFDByteOffset:]))
+
+		alignment := uint64(4)
+		if compress == CompressBC4 {
+			assert.Equal(t, uint32(VK_FORMAT_BC4_UNORM_BLOCK), header.VkFormat)
+			alignment = 8
+		} else {
+			assert.Equal(t, uint32(VK_FORMAT_R8_UNORM), header.VkFormat)
+		}
+
+		// Every level has the same texels as in the DDS order, and the
+		// smallest level comes first
+		offset := uint64(0)
+		for i, level := range levels {
+			assert.Zero(t, level.ByteOffset%alignment)
+			assert.Equal(t, result.Texture.Data[offset:offset+level.ByteLength], file[level.ByteOffset:level.ByteOffset+level.ByteLength])
+			if i > 0 {
+				assert.Less(t, level.ByteOffset, levels[i-1].ByteOffset)
+			}
+			offset += level.ByteLength
+		}
+
+		assert.Equal(t, uint64(len(result.Texture.Data)), offset)
+		assert.Equal(t, uint64(len(file)), levels[0].ByteOffset+levels[0].ByteLength)
+	}
+
+	// The data must match the size of the levels
+	assert.Error(t, Write3DTextureAsKTX2(io.Discard, make([]byte, 10), 4, 4, 4, VK_FORMAT_R8_UNORM, 1))
+}
+
+func TestBricks(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.Resolution = 16
+	options.BrickSize = 4
+	options.Band = 1.0
+
+	result, err := Bake(context.Background(), mesh, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The full grid the bricks are cut from. The signs of the texels where
+	// the closest triangles tie depend on the order of the search, and
+	// calculate flips the ones that disagree along its rows, so the grid is
+	// compared by magnitude.
+	field := result.Field
+	settings := options.settings(field.Width, field.Height, field.Depth)
+	grid, err := calculate(context.Background(), settings, *mesh, field.GridMin, field.GridMax, nil)
+	assert.NoError(t, err)
+
+	bricks := result.bricks
+	stored := bricks.storedSize()
+	band := options.Band * texelSize(field.Width, field.GridMin, field.GridMax, field.Sampling)
+
+	// The json describes the written atlas
+	width, height, depth := result.Metadata["texture_width"].(int), result.Metadata["texture_height"].(int), result.Metadata["texture_depth"].(int)
+	atlasBricks := result.Metadata["atlas_bricks"].([3]int)
+	assert.Equal(t, 4, result.Metadata["brick_size"])
+	assert.Equal(t, 6, result.Metadata["brick_stored_size"])
+	assert.Equal(t, [3]int{width / stored, height / stored, depth / stored}, atlasBricks)
+	assert.Equal(t, width*height*depth, len(result.Texture.Data))
+	assert.Equal(t, len(bricks.bricks), result.Metadata["brick_count"])
+	assert.LessOrEqual(t, len(bricks.bricks), atlasBricks[0]*atlasBricks[1]*atlasBricks[2])
+
+	indirection := result.Volumes[0]
+	assert.Equal(t, "indirection", indirection.Name)
+	assert.Equal(t, []int{bricks.bricksX, bricks.bricksY, bricks.bricksZ}, []int{indirection.Width, indirection.Height, indirection.Depth})
+	assert.Equal(t, (field.Width+3)/4, bricks.bricksX)
+
+	stores := 0
+	for bz := range bricks.bricksZ {
+		for by := range bricks.bricksY {
+			for bx := range bricks.bricksX {
+				i := bx + by*bricks.bricksX + bz*bricks.bricksX*bricks.bricksY
+				entry := indirection.Data[i*4 : i*4+4]
+
+				// Closest distance of the grid texels of the brick and its apron
+				closest := posBigfloat64
+				for z := bz*4 - 1; z <= bz*4+4; z++ {
+					for y := by*4 - 1; y <= by*4+4; y++ {
+						for x := bx*4 - 1; x <= bx*4+4; x++ {
+							if x >= 0 && y >= 0 && z >= 0 && x < field.Width && y < field.Height && z < field.Depth {
+								closest = min(closest, math.Abs(grid.Data[x+y*field.Width+z*field.Width*field.Height]))
+							}
+						}
+					}
+				}
+
+				if entry[3] == 0 {
+					assert.Equal(t, brickEmpty, bricks.indirection[i])
+					assert.Greater(t, closest, band)
+					continue
+				}
+
+				stores++
+				assert.Equal(t, byte(255), entry[3])
+				assert.LessOrEqual(t, closest, band)
+
+				// The entry points at the slot of the brick in the atlas
+				index := bricks.indirection[i]
+				ax, ay, az := bricks.atlasPosition(index)
+				assert.Equal(t, []byte{byte(ax), byte(ay), byte(az)}, entry[:3])
+
+				// Every texel of the brick, apron included, is the grid texel
+				// at the same coordinates, and is written to its slot
+				brick := bricks.bricks[index]
+				quantized, _ := quantize(settings, brick, result.MinD, result.MaxD, nil)
+
+				for z := range stored {
+					for y := range stored {
+						for x := range stored {
+							b := x + y*stored + z*stored*stored
+							assert.Equal(t, quantized[b], result.Texture.Data[ax*stored+x+(ay*stored+y)*width+(az*stored+z)*width*height])
+
+							gx, gy, gz := bx*4+x-1, by*4+y-1, bz*4+z-1
+							if gx >= 0 && gy >= 0 && gz >= 0 && gx < field.Width && gy < field.Height && gz < field.Depth {
+								assert.InDelta(t, math.Abs(grid.Data[gx+gy*field.Width+gz*field.Width*field.Height]), math.Abs(brick[b]), 1e-9)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, len(bricks.bricks), stores)
+	assert.Positive(t, stores)
+	assert.Less(t, stores, len(bricks.indirection))
+}
+
+// Keeps everything a bake logs
+type testLogger struct {
+	messages []string
+	warnings []Warning
+	stages   map[string][2]int
+}
+
+func (l *testLogger) Progress(stage string, done, total int) {
+	l.stages[stage] = [2]int{done, total}
+}
+
+func (l *testLogger) Message(text string) {
+	l.messages = append(l.messages, text)
+}
+
+func (l *testLogger) Warning(text string, triangle int) {
+	l.warnings = append(l.warnings, Warning{text, triangle})
+}
+
+func TestHybrid(t *testing.T) {
+	assert.Equal(t, 1.5, eikonalUpdate(0.5, math.Inf(1), math.Inf(1), 1.0))
+	assert.InDelta(t, 1.0/math.Sqrt(2.0), eikonalUpdate(0.0, 0.0, math.Inf(1), 1.0), 1e-12)
+
+	// A closed wall around the center of a 5^3 grid keeps it out of the exterior
+	open := make([]bool, 125)
+	for i := range open {
+		x, y, z := i%5, i/5%5, i/25
+		open[i] = max(abs(x-2), abs(y-2), abs(z-2)) != 1
+	}
+	exterior := floodExterior(5, 5, 5, open)
+	assert.True(t, exterior[0])
+	assert.False(t, exterior[62])
+
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.Hybrid = true
+	options.HybridReport = true
+
+	r, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	field := r.Field
+	assert.True(t, field.exactTexels > 0 && field.exactTexels < len(field.Data))
+	assert.Contains(t, r.Metadata, "hybrid_error_max")
+
+	// Swept texels are inside when they're on the inner side of every face
+	center := vec.Scale(vec.Add(vec.Add(mesh.Vertices[0], mesh.Vertices[1]), vec.Add(mesh.Vertices[2], mesh.Vertices[3])), 0.25)
+	pointScale, pointBias := gridScaleBias(field.Width, field.Height, field.Depth, field.GridMin, field.GridMax, field.Sampling)
+	triangleLists := mesh.createTriangleLists(field.Width, field.Height, field.Depth, field.GridMin, field.GridMax)
+	swept := 0
+
+	for i, d := range field.Data {
+		p := vec.Add(vec.Mul(vec.Vec3{float64(i % field.Width), float64(i / field.Width % field.Height), float64(i / (field.Width * field.Height))}, pointScale), pointBias)
+		if mesh.nearTriangles(p, triangleLists[i], math.Sqrt(3.0)*pointScale[0]) {
+			continue
+		}
+		swept++
+
+		inside := true
+		for _, triangle := range mesh.Triangles {
+			a, b, c := mesh.Vertices[triangle[0]], mesh.Vertices[triangle[1]], mesh.Vertices[triangle[2]]
+			n := vec.Cross(vec.Sub(b, a), vec.Sub(c, a))
+			inside = inside && vec.Dot(n, vec.Sub(p, a))*vec.Dot(n, vec.Sub(center, a)) > 0.0
+		}
+
+		assert.Equal(t, inside, d < 0.0, "texel %d", i)
+	}
+
+	assert.Equal(t, len(field.Data)-field.exactTexels, swept)
+}
+
+func TestFloodFillSigns(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	// Two of the faces wound the other way
+	mesh.Triangles[0][1], mesh.Triangles[0][2] = mesh.Triangles[0][2], mesh.Triangles[0][1]
+	mesh.Triangles[3][1], mesh.Triangles[3][2] = mesh.Triangles[3][2], mesh.Triangles[3][1]
+
+	options := DefaultOptions()
+	options.Sign = SignFloodFill
+
+	r, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+	assert.Equal(t, SignFloodFill, r.Metadata["sign_mode"])
+
+	field := r.Field
+	assert.True(t, field.signDifferences > 0)
+
+	// Texels off the surface are inside when they're on the inner side of every face
+	center := vec.Scale(vec.Add(vec.Add(mesh.Vertices[0], mesh.Vertices[1]), vec.Add(mesh.Vertices[2], mesh.Vertices[3])), 0.25)
+	pointScale, pointBias := gridScaleBias(field.Width, field.Height, field.Depth, field.GridMin, field.GridMax, field.Sampling)
+	triangleLists := mesh.createTriangleLists(field.Width, field.Height, field.Depth, field.GridMin, field.GridMax)
+	interior := 0
+
+	for i, d := range field.Data {
+		p := vec.Add(vec.Mul(vec.Vec3{float64(i % field.Width), float64(i / field.Width % field.Height), float64(i / (field.Width * field.Height))}, pointScale), pointBias)
+		if mesh.nearTriangles(p, triangleLists[i], 0.5*pointScale[0]) {
+			continue
+		}
+
+		inside := true
+		for _, triangle := range mesh.Triangles {
+			a, b, c := mesh.Vertices[triangle[0]], mesh.Vertices[triangle[1]], mesh.Vertices[triangle[2]]
+			n := vec.Cross(vec.Sub(b, a), vec.Sub(c, a))
+			inside = inside && vec.Dot(n, vec.Sub(p, a))*vec.Dot(n, vec.Sub(center, a)) > 0.0
+		}
+
+		assert.Equal(t, inside, d < 0.0, "texel %d", i)
+		if inside {
+			interior++
+		}
+	}
+
+	assert.True(t, interior > 0)
+}
+
+func TestSupersample(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	point, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+	assert.NotContains(t, point.Metadata, "supersample")
+
+	// With an odd number of sub-samples one of them is the texel sample, so
+	// the closest one is never further from the surface
+	options.Supersample = 3
+	r, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, r.Metadata["supersample"])
+	assert.Equal(t, FilterMin, r.Metadata["supersample_filter"])
+
+	for i, d := range r.Field.Data {
+		assert.LessOrEqual(t, math.Abs(d), math.Abs(point.Field.Data[i]), "texel %d", i)
+	}
+
+	options.SupersampleFilter = FilterAverage
+	r, err = Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+	assert.Equal(t, FilterAverage, r.Metadata["supersample_filter"])
+
+	options.ADF = true
+	assert.Error(t, options.Validate())
+
+	options = DefaultOptions()
+	options.Supersample = 0
+	assert.Error(t, options.Validate())
+}
+
+// Samples a 16 bits distance texture like a GPU, trilinear filtering and
+// clamping to the edge, mapping p into the grid box with the shader of
+// unpack.glsl for the sampling of the result
+func sampleTexture(r *Result, p vec.Vec3) float64 {
+	gridMin := r.Metadata["grid_bounding_box_min"].(vec.Vec3)
+	gridMax := r.Metadata["grid_bounding_box_max"].(vec.Vec3)
+	size := [3]int{r.Texture.Width, r.Texture.Height, r.Texture.Depth}
+
+	texel := func(x, y, z int) float64 {
+		x = vec.Clamp(x, 0, size[0]-1)
+		y = vec.Clamp(y, 0, size[1]-1)
+		z = vec.Clamp(z, 0, size[2]-1)
+
+		i := (x + y*size[0] + z*size[0]*size[1]) * 2
+		return float64(uint16(r.Texture.Data[i])|uint16(r.Texture.Data[i+1])<<8) / 65535.0
+	}
+
+	var base [3]int
+	var frac [3]float64
+	for i := range 3 {
+		uvw := (p[i] - gridMin[i]) / (gridMax[i] - gridMin[i])
+		if r.Metadata["grid_sampling"] == SamplingCorner {
+			uvw = (uvw*float64(size[i]-1) + 0.5) / float64(size[i])
+		}
+
+		// Texel centers are at half integer coordinates
+		t := uvw*float64(size[i]) - 0.5
+		base[i] = int(math.Floor(t))
+		frac[i] = t - math.Floor(t)
+	}
+
+	d := 0.0
+	for corner := range 8 {
+		w := 1.0
+		var c [3]int
+		for i := range 3 {
+			c[i] = base[i]
+			if corner>>i&1 == 1 {
+				c[i]++
+				w *= frac[i]
+			} else {
+				w *= 1.0 - frac[i]
+			}
+		}
+
+		d += w * texel(c[0], c[1], c[2])
+	}
+
+	return d*(r.MaxD-r.MinD) + r.MinD
+}
+
+func TestSampling(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	options := DefaultOptions()
+	options.Type = Type16
+
+	corner, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	options.Sampling = SamplingCenter
+	center, err := Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	// Same samples, in a box half a texel bigger
+	assert.Equal(t, corner.Texture.Data, center.Texture.Data)
+	assert.InDelta(t, corner.Metadata["texel_size"].(float64), center.Metadata["texel_size"].(float64), 1e-12)
+
+	half := 0.5 * corner.Metadata["texel_size"].(float64)
+	for i := range 3 {
+		assert.InDelta(t, corner.Field.GridMin[i]-half, center.Field.GridMin[i], 1e-3)
+		assert.InDelta(t, corner.Field.GridMax[i]+half, center.Field.GridMax[i], 1e-3)
+	}
+
+	// The texture sampled at the texels has the distances to the mesh, up
+	// to the quantization. Signs are left out, the bake fixes some of them.
+	step := (corner.MaxD - corner.MinD) / 65535.0
+	for _, r := range []*Result{corner, center} {
+		field := r.Field
+		pointScale, pointBias := gridScaleBias(field.Width, field.Height, field.Depth, field.GridMin, field.GridMax, field.Sampling)
+
+		for i := 0; i < len(field.Data); i += 7 {
+			p := vec.Add(vec.Mul(vec.Vec3{float64(i % field.Width), float64(i / field.Width % field.Height), float64(i / (field.Width * field.Height))}, pointScale), pointBias)
+			assert.InDelta(t, math.Abs(mesh.distanceBruteForce(p)), math.Abs(sampleTexture(r, p)), step, "%s texel %d", field.Sampling, i)
+		}
+	}
+
+	options.ADF = true
+	assert.Error(t, options.Validate())
+}
+
+func abs(v int) int {
+	return max(v, -v)
+}
+
+func TestPool(t *testing.T) {
+	counts := make([]int, 100)
+	workers := make([]int, 100)
+	runPool(context.Background(), 3, len(counts), func(worker, tile int) {
+		counts[tile]++
+		workers[tile] = worker
+	})
+
+	for tile := range counts {
+		assert.Equal(t, 1, counts[tile])
+		assert.True(t, workers[tile] >= 0 && workers[tile] < 3)
+	}
+
+	visited := newVisitedSet(4)
+	visited.reset()
+	assert.True(t, visited.visit(2))
+	assert.False(t, visited.visit(2))
+	visited.reset()
+	assert.True(t, visited.visit(2))
+
+	// The number of workers doesn't change the result
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	settings := distanceSettings{width: 16, height: 16, depth: 16, threads: 1}
+	one, err := calculate(context.Background(), settings, *mesh, mesh.Min, mesh.Max, nil)
+	assert.NoError(t, err)
+
+	settings.threads = 0
+	all, err := calculate(context.Background(), settings, *mesh, mesh.Min, mesh.Max, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, one, all)
+
+	// Same for the octree, compression and occlusion
+	rootMin := vec.Vec3{-1.5, -1.5, -1.5}
+	adfOne, failedOne, err := buildADF(context.Background(), *mesh, rootMin, 3.0, 4, 0.01, false, 1, nil)
+	assert.NoError(t, err)
+	adfAll, failedAll, err := buildADF(context.Background(), *mesh, rootMin, 3.0, 4, 0.01, false, 3, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, adfOne, adfAll)
+	assert.Equal(t, failedOne, failedAll)
+
+	values := make([]int, 16*16*16)
+	for i := range values {
+		values[i] = (i * 37) % 256
+	}
+	blocksOne, errorOne := encodeBC4(values, 16, 16, 16, false, 1)
+	blocksAll, errorAll := encodeBC4(values, 16, 16, 16, false, 3)
+	assert.Equal(t, blocksOne, blocksAll)
+	assert.Equal(t, errorOne, errorAll)
+
+	occlusionOne, thicknessOne, maxOne := one.occlusionAndThickness(0.1, 4.0, 1)
+	occlusionAll, thicknessAll, maxAll := one.occlusionAndThickness(0.1, 4.0, 3)
+	assert.Equal(t, occlusionOne, occlusionAll)
+	assert.Equal(t, thicknessOne, thicknessAll)
+	assert.Equal(t, maxOne, maxAll)
+}
+
+func TestLogger(t *testing.T) {
+	mesh, err := LoadOBJ("../../tetrahedron.obj")
+	assert.NoError(t, err)
+
+	// A closed mesh has nothing to complain about
+	mesh.FixTriangles(0)
+	assert.Empty(t, mesh.Warnings)
+
+	logger := &testLogger{stages: map[string][2]int{}}
+	options := DefaultOptions()
+	options.Resolution = 16
+	options.Progress = logger
+
+	_, err = Bake(context.Background(), mesh, options)
+	assert.NoError(t, err)
+
+	assert.Contains(t, logger.messages, "Output resolution: 16 x 14 x 15")
+	assert.Contains(t, logger.stages, "Calculating distance field")
+	assert.Contains(t, logger.stages, "Converting data")
+	for stage, progress := range logger.stages {
+		assert.Equal(t, progress[1], progress[0], stage)
+	}
+	for _, warning := range logger.warnings {
+		assert.True(t, warning.Triangle >= -1 && warning.Triangle < len(mesh.Triangles))
+	}
+
+	// The texels with an inverted sign are one warning with their count, not one each
+	inverted := 0
+	for _, warning := range logger.warnings {
+		if strings.HasPrefix(warning.Text, "inverted the sign") {
+			inverted++
+			assert.Regexp(t, `^inverted the sign of the distance of \d+ texels, closest to [1-4] triangles \[[0-3]( [0-3])*\]$`, warning.Text)
+		}
+	}
+	assert.Equal(t, 1, inverted)
+}
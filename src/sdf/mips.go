@@ -0,0 +1,97 @@
+package sdf
+
+import (
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// One level of the mip chain
+type mipLevel struct {
+	width, height, depth int
+	data                 []float64
+	minD, maxD           float64
+}
+
+// Number of levels in a full mip chain, down to a single texel
+func mipCount(width, height, depth int) int {
+	count := 1
+	for size := vec.Max3(width, height, depth); size > 1; size /= 2 {
+		count++
+	}
+
+	return count
+}
+
+/*
+Halves the resolution of a level. Each texel keeps the value with the smallest
+magnitude of its source block, with its sign, so the distance is never
+overestimated and it's safe to use for cone tracing.
+*/
+func downsample(src mipLevel) mipLevel {
+	dst := mipLevel{
+		width:  vec.Max(1, src.width/2),
+		height: vec.Max(1, src.height/2),
+		depth:  vec.Max(1, src.depth/2),
+		minD:   posBigfloat64,
+		maxD:   negBigfloat64,
+	}
+	dst.data = make([]float64, dst.width*dst.height*dst.depth)
+
+	// Source texels covered by destination texel i, the last texel also
+	// takes the leftover one when the source size is odd
+	span := func(i, srcSize, dstSize int) (int, int) {
+		if i == dstSize-1 {
+			return 2 * i, srcSize - 1
+		}
+		return 2 * i, vec.Min(2*i+1, srcSize-1)
+	}
+
+	for z := range dst.depth {
+		z0, z1 := span(z, src.depth, dst.depth)
+
+		for y := range dst.height {
+			y0, y1 := span(y, src.height, dst.height)
+
+			for x := range dst.width {
+				x0, x1 := span(x, src.width, dst.width)
+				d := posBigfloat64
+
+				for zz := z0; zz <= z1; zz++ {
+					for yy := y0; yy <= y1; yy++ {
+						for xx := x0; xx <= x1; xx++ {
+							v := src.data[xx+yy*src.width+zz*src.width*src.height]
+							if math.Abs(v) < math.Abs(d) {
+								d = v
+							}
+						}
+					}
+				}
+
+				dst.data[x+y*dst.width+z*dst.width*dst.height] = d
+				dst.minD = min(dst.minD, d)
+				dst.maxD = max(dst.maxD, d)
+			}
+		}
+	}
+
+	return dst
+}
+
+// Creates the full mip chain of a distance field, starting with the field itself
+func buildMipChain(field DistanceField) []mipLevel {
+	levels := []mipLevel{{
+		width:  field.Width,
+		height: field.Height,
+		depth:  field.Depth,
+		data:   field.Data,
+		minD:   field.MinD,
+		maxD:   field.MaxD,
+	}}
+
+	for range mipCount(field.Width, field.Height, field.Depth) - 1 {
+		levels = append(levels, downsample(levels[len(levels)-1]))
+	}
+
+	return levels
+}
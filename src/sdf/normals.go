@@ -0,0 +1,151 @@
+package sdf
+
+import (
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// World position of a texel
+func (f *DistanceField) position(x, y, z int) vec.Vec3 {
+	pointScale, pointBias := gridScaleBias(f.Width, f.Height, f.Depth, f.GridMin, f.GridMax, f.Sampling)
+	return vec.Add(vec.Mul(vec.Vec3{float64(x), float64(y), float64(z)}, pointScale), pointBias)
+}
+
+// Distance at a texel, coordinates outside of the grid are clamped
+func (f *DistanceField) at(x, y, z int) float64 {
+	x = vec.Clamp(x, 0, f.Width-1)
+	y = vec.Clamp(y, 0, f.Height-1)
+	z = vec.Clamp(z, 0, f.Depth-1)
+
+	return f.Data[x+y*f.Width+z*f.Width*f.Height]
+}
+
+// Gradient at a texel using central differences, one sided on the borders, in distance per texel
+func (f *DistanceField) gradient(x, y, z int) vec.Vec3 {
+	diff := func(a, b float64, i, size int) float64 {
+		if i == 0 || i == size-1 {
+			return b - a
+		}
+		return (b - a) * 0.5
+	}
+
+	return vec.Vec3{
+		diff(f.at(x-1, y, z), f.at(x+1, y, z), x, f.Width),
+		diff(f.at(x, y-1, z), f.at(x, y+1, z), y, f.Height),
+		diff(f.at(x, y, z-1), f.at(x, y, z+1), z, f.Depth),
+	}
+}
+
+/*
+Normalized gradient of each texel. The analytic gradient is the direction from
+the closest point on the mesh to the texel (flipped inside), and needs the
+closest triangle of each texel. Texels on the surface use the triangle normal.
+Otherwise the gradient is calculated with central differences.
+*/
+func fieldNormals(mesh Mesh, field DistanceField, analytic bool) []vec.Vec3 {
+	normals := make([]vec.Vec3, len(field.Data))
+
+	for z := range field.Depth {
+		for y := range field.Height {
+			for x := range field.Width {
+				i := x + y*field.Width + z*field.Width*field.Height
+
+				if !analytic {
+					g := field.gradient(x, y, z)
+					if vec.Dot2(g) > 0.0 {
+						normals[i] = vec.Normalize(g)
+					}
+					continue
+				}
+
+				triangle := mesh.Triangles[field.Triangles[i]]
+				v0 := mesh.Vertices[triangle[0]]
+				v1 := mesh.Vertices[triangle[1]]
+				v2 := mesh.Vertices[triangle[2]]
+
+				p := field.position(x, y, z)
+				q, _ := closestPoint(p, v0, v1, v2)
+				g := vec.Scale(vec.Sub(p, q), vec.Sign(field.Data[i]))
+
+				if vec.Dot2(g) < 1e-20 {
+					// distance() is positive on the opposite side of this normal
+					g = vec.Scale(vec.Cross(vec.Sub(v1, v0), vec.Sub(v0, v2)), -1.0)
+				}
+
+				normals[i] = vec.Normalize(g)
+			}
+		}
+	}
+
+	return normals
+}
+
+// Octahedral encoding of a unit vector, in [-1, 1]
+func octEncode(n vec.Vec3) (float64, float64) {
+	l := math.Abs(n[0]) + math.Abs(n[1]) + math.Abs(n[2])
+	x, y := n[0]/l, n[1]/l
+
+	if n[2] < 0.0 {
+		x, y = (1.0-math.Abs(y))*signNotZero(x), (1.0-math.Abs(x))*signNotZero(y)
+	}
+
+	return x, y
+}
+
+func signNotZero(v float64) float64 {
+	if v < 0.0 {
+		return -1.0
+	}
+	return 1.0
+}
+
+// Stores a value in [0, 1] as an 8 or 16 bits unsigned normalized integer, little endian
+func putUnorm(out []byte, v float64, bits int) {
+	v = vec.Saturate(v)
+
+	if bits == 16 {
+		t := uint16(math.Round(v * 65535.0))
+		out[0] = byte(t & 0xFF)
+		out[1] = byte((t >> 8) & 0xFF)
+	} else {
+		out[0] = uint8(math.Round(v * 255.0))
+	}
+}
+
+/*
+Packs the normals in RGB and the already quantized distances in A, as 8 or 16
+bits per channel. Normals are mapped from [-1, 1] to [0, 1].
+*/
+func packNormalsRGBA(normals []vec.Vec3, distances []byte, bits int) []byte {
+	size := bits / 8
+	out := make([]byte, len(normals)*4*size)
+
+	for i, n := range normals {
+		texel := out[i*4*size:]
+		for c := range 3 {
+			putUnorm(texel[c*size:], n[c]*0.5+0.5, bits)
+		}
+		copy(texel[3*size:4*size], distances[i*size:])
+	}
+
+	return out
+}
+
+// Packs octahedral encoded normals in RG, as 8 or 16 bits per channel, mapped from [-1, 1] to [0, 1]
+func packNormalsOct(normals []vec.Vec3, bits int) []byte {
+	size := bits / 8
+	out := make([]byte, len(normals)*2*size)
+
+	for i, n := range normals {
+		x, y := 0.0, 0.0
+		if vec.Dot2(n) > 0.0 {
+			x, y = octEncode(n)
+		}
+
+		putUnorm(out[i*2*size:], x*0.5+0.5, bits)
+		putUnorm(out[i*2*size+size:], y*0.5+0.5, bits)
+	}
+
+	return out
+}
@@ -0,0 +1,428 @@
+package sdf
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Type is the number of bits of each distance
+type Type int
+
+const (
+	Type8  Type = 8
+	Type16 Type = 16
+)
+
+// Mirror holds the mirror mode flags of each axis
+type Mirror uint16
+
+const (
+	MirrorX              Mirror = convertionOptionsMirrorX
+	MirrorXIncludeCenter Mirror = convertionOptionsMirrorXIncludeCenter
+	MirrorXNegative      Mirror = convertionOptionsMirrorXNegative
+	MirrorY              Mirror = convertionOptionsMirrorY
+	MirrorYIncludeCenter Mirror = convertionOptionsMirrorYIncludeCenter
+	MirrorYNegative      Mirror = convertionOptionsMirrorYNegative
+	MirrorZ              Mirror = convertionOptionsMirrorZ
+	MirrorZIncludeCenter Mirror = convertionOptionsMirrorZIncludeCenter
+	MirrorZNegative      Mirror = convertionOptionsMirrorZNegative
+)
+
+// Format is the file format of the textures
+type Format string
+
+const (
+	FormatBin  Format = "bin" // Raw texels
+	FormatDDS  Format = "dds"
+	FormatKTX2 Format = "ktx2"
+)
+
+// Units of the distances
+type Units string
+
+const (
+	UnitsWorld Units = "world" // Units of the mesh
+	UnitsTexel Units = "texel" // Texels of the grid
+)
+
+// Compression is the block compression of the distance texture
+type Compression string
+
+const (
+	CompressNone      Compression = "none"
+	CompressBC4       Compression = "bc4"
+	CompressBC4Signed Compression = "bc4s"
+)
+
+// Normals is where the normal channels come from
+type Normals string
+
+const (
+	NormalsNone     Normals = "none"
+	NormalsAnalytic Normals = "analytic" // Direction to the closest point
+	NormalsCentral  Normals = "central"  // Central differences of the grid
+)
+
+// NormalPack is how the normals are stored
+type NormalPack string
+
+const (
+	NormalPackRGBA NormalPack = "rgba" // Normal in RGB and distance in A
+	NormalPackOct  NormalPack = "oct"  // Octahedral RG volume next to the distance
+)
+
+// Vectors is the format of the closest point vector volume
+type Vectors string
+
+const (
+	VectorsNone  Vectors = "none"
+	VectorsHalf  Vectors = "half"  // RGBA16F
+	VectorsSnorm Vectors = "snorm" // RGBA8 or RGBA16 signed normalized
+)
+
+// Albedo is where the colors of the color volume come from
+type Albedo string
+
+const (
+	AlbedoNone    Albedo = "none"
+	AlbedoTexture Albedo = "texture" // map_Kd texture of the closest point
+	AlbedoVertex  Albedo = "vertex"  // Vertex colors of the closest point
+)
+
+// Sign is where the signs of the distances come from
+type Sign string
+
+const (
+	SignTriangles Sign = "triangles" // Normal of the closest triangle
+	SignFloodFill Sign = "floodfill" // Flood fill of the exterior from the border of the grid
+)
+
+// Sampling is where the texels are sampled in the grid bounding box
+type Sampling string
+
+const (
+	SamplingCorner Sampling = "corner" // The first and last texels are on the box, (textureSize - 1) * uvw + 0.5 in a shader
+	SamplingCenter Sampling = "center" // The box is the outside of the texels, uvw as is in a shader
+)
+
+// Filter is how the sub-samples of a texel are combined
+type Filter string
+
+const (
+	FilterMin     Filter = "min"     // The sub-sample closest to the surface, never further than the true minimum
+	FilterAverage Filter = "average" // Box filter
+)
+
+// Range of distances used for quantization, values outside are clamped
+type Range struct {
+	Min, Max float64
+}
+
+// Options of a bake, start from DefaultOptions
+type Options struct {
+	Resolution int // Biggest side of the grid, in texels
+	Type       Type
+	Mirror     Mirror
+	Format     Format
+	Units      Units
+
+	// Fixed quantization range, in world units, or texels with RangeTexels.
+	// The range of the distances of the mesh when Min isn't smaller than Max.
+	Range       Range
+	RangeTexels bool
+
+	// Bounds of the mesh used to size the grid instead of its own, when they
+	// aren't both zero, so several meshes share a grid. BoundsMin must be
+	// smaller than BoundsMax on every axis.
+	BoundsMin, BoundsMax vec.Vec3
+
+	Mips      bool // Full mip chain
+	Compress  Compression
+	BrickSize int     // Sparse bricks of this many texels per side, when not zero
+	Band      float64 // In texels, for bricks, occlusion, thickness and curvature
+	ADF       bool    // Adaptive octree instead of a grid
+	Tolerance float64 // Octree interpolation tolerance, in texels
+
+	Normals    Normals
+	NormalPack NormalPack
+	Vectors    Vectors
+	VectorSign bool   // Sign of the distance in the alpha of the vector volume
+	Triangles  bool   // Closest triangle and barycentric coordinates volumes
+	Materials  bool   // Material index volume
+	Albedo     Albedo // Color volume
+	Occlusion  bool   // Ambient occlusion and thickness volume
+	Curvature  bool   // Mean and Gaussian curvature volume
+
+	// Where the texels are in the grid bounding box of the json. The samples
+	// are the same either way, half a texel out of the mesh on its biggest
+	// side, the box is half a texel bigger with center sampling.
+	Sampling Sampling
+
+	// Signs from the triangle normals, or a flood fill of the exterior around
+	// the surface rasterized into the grid, which doesn't care about winding
+	Sign Sign
+
+	// Distance of each texel filtered from Supersample^3 sub-samples spread
+	// over the texel, when bigger than one
+	Supersample       int
+	SupersampleFilter Filter
+
+	// Workers of the bake, for the distances, octree, block compression and
+	// occlusion, GOMAXPROCS when zero
+	Threads int
+
+	// Distances calculated in float32, faster but less precise
+	Float32 bool
+
+	// Exact distances only for the texels near the surface, the rest are
+	// solved by fast sweeping with signs from a flood fill of the exterior.
+	// HybridReport also calculates the exact field, to report the error.
+	Hybrid       bool
+	HybridReport bool
+
+	// Receives the progress of the long stages, nil for none
+	Progress Progress
+}
+
+// DefaultOptions returns the options of the command line tool when none are given
+func DefaultOptions() Options {
+	return Options{
+		Resolution: 32,
+		Type:       Type8,
+		Format:     FormatBin,
+		Units:      UnitsWorld,
+		Compress:   CompressNone,
+		Band:       4.0,
+		Tolerance:  0.1,
+		Normals:    NormalsNone,
+		NormalPack: NormalPackRGBA,
+		Vectors:    VectorsNone,
+		Albedo:     AlbedoNone,
+		Sign:       SignTriangles,
+		Sampling:   SamplingCorner,
+
+		Supersample:       1,
+		SupersampleFilter: FilterMin,
+	}
+}
+
+// Validate checks that the options are valid, and work together
+func (o Options) Validate() error {
+	if o.Type != Type8 && o.Type != Type16 {
+		return fmt.Errorf("output type must be 8 or 16")
+	}
+
+	if o.Resolution < 16 || o.Resolution > resLimit {
+		return fmt.Errorf("output resolution must be between 16 and %d", resLimit)
+	}
+
+	if o.Format != FormatBin && o.Format != FormatDDS && o.Format != FormatKTX2 {
+		return fmt.Errorf("output format must be \"bin\", \"dds\" or \"ktx2\"")
+	}
+
+	if o.Units != UnitsWorld && o.Units != UnitsTexel {
+		return fmt.Errorf("units must be \"world\" or \"texel\"")
+	}
+
+	if o.Compress != CompressNone && o.Compress != CompressBC4 && o.Compress != CompressBC4Signed {
+		return fmt.Errorf("compression must be \"none\", \"bc4\" or \"bc4s\"")
+	}
+
+	if o.Compress != CompressNone && o.Type != Type8 {
+		return fmt.Errorf("block compression needs 8 bits output")
+	}
+
+	if o.BrickSize < 0 || o.BrickSize > 0 && (o.Mips || o.Compress != CompressNone) {
+		return fmt.Errorf("bricks can't be smaller than zero, or used with mips or block compression")
+	}
+
+	if o.ADF && (o.BrickSize > 0 || o.Mips || o.Compress != CompressNone || o.Units != UnitsWorld) {
+		return fmt.Errorf("the octree output can't be used with bricks, mips, block compression or texel units")
+	}
+
+	if o.Normals != NormalsNone && o.Normals != NormalsAnalytic && o.Normals != NormalsCentral || o.NormalPack != NormalPackRGBA && o.NormalPack != NormalPackOct {
+		return fmt.Errorf("normals must be \"none\", \"analytic\" or \"central\", and packed as \"rgba\" or \"oct\"")
+	}
+
+	if o.Normals != NormalsNone && (o.BrickSize > 0 || o.ADF || o.Mips || o.Compress != CompressNone) {
+		return fmt.Errorf("normals can't be used with bricks, octrees, mips or block compression")
+	}
+
+	if o.Vectors != VectorsNone && o.Vectors != VectorsHalf && o.Vectors != VectorsSnorm {
+		return fmt.Errorf("vectors must be \"none\", \"half\" or \"snorm\"")
+	}
+
+	if o.Vectors != VectorsNone && (o.BrickSize > 0 || o.ADF) {
+		return fmt.Errorf("vectors can't be used with bricks or octrees")
+	}
+
+	if o.Hybrid && (o.BrickSize > 0 || o.ADF || o.Normals == NormalsAnalytic || o.Vectors != VectorsNone || o.Triangles || o.Materials || o.Albedo != AlbedoNone) {
+		return fmt.Errorf("hybrid fields can't be used with bricks, octrees, analytic normals, or vector, triangle, material and color volumes")
+	}
+
+	if o.HybridReport && !o.Hybrid {
+		return fmt.Errorf("the hybrid report needs a hybrid field")
+	}
+
+	if o.Sampling != SamplingCorner && o.Sampling != SamplingCenter {
+		return fmt.Errorf("sampling must be \"corner\" or \"center\"")
+	}
+
+	if o.Sampling == SamplingCenter && o.ADF {
+		return fmt.Errorf("center sampling can't be used with octrees")
+	}
+
+	if o.Sign != SignTriangles && o.Sign != SignFloodFill {
+		return fmt.Errorf("sign must be \"triangles\" or \"floodfill\"")
+	}
+
+	if o.Sign == SignFloodFill && (o.BrickSize > 0 || o.ADF) {
+		return fmt.Errorf("flood fill signs can't be used with bricks or octrees")
+	}
+
+	if o.Supersample < 1 || o.Supersample > 8 {
+		return fmt.Errorf("supersampling must be between 1 and 8")
+	}
+
+	if o.SupersampleFilter != FilterMin && o.SupersampleFilter != FilterAverage {
+		return fmt.Errorf("supersampling filter must be \"min\" or \"average\"")
+	}
+
+	if o.Supersample > 1 && (o.BrickSize > 0 || o.ADF || o.Normals == NormalsAnalytic || o.Vectors != VectorsNone || o.Triangles || o.Materials || o.Albedo != AlbedoNone) {
+		return fmt.Errorf("supersampling can't be used with bricks, octrees, analytic normals, or vector, triangle, material and color volumes")
+	}
+
+	if o.hasBounds() && (o.BoundsMin[0] >= o.BoundsMax[0] || o.BoundsMin[1] >= o.BoundsMax[1] || o.BoundsMin[2] >= o.BoundsMax[2]) {
+		return fmt.Errorf("the minimum of the bounds must be smaller than the maximum on every axis")
+	}
+
+	if o.Threads < 0 {
+		return fmt.Errorf("threads can't be smaller than zero")
+	}
+
+	if o.Albedo != AlbedoNone && o.Albedo != AlbedoTexture && o.Albedo != AlbedoVertex {
+		return fmt.Errorf("albedo must be \"none\", \"texture\" or \"vertex\"")
+	}
+
+	if (o.Triangles || o.Materials || o.Albedo != AlbedoNone || o.Occlusion || o.Curvature) && (o.BrickSize > 0 || o.ADF) {
+		return fmt.Errorf("triangle, material, color, occlusion, thickness and curvature volumes can't be used with bricks or octrees")
+	}
+
+	return nil
+}
+
+// Reports whether the grid is sized from BoundsMin and BoundsMax
+func (o Options) hasBounds() bool {
+	return o.BoundsMin != (vec.Vec3{}) || o.BoundsMax != (vec.Vec3{})
+}
+
+// Packable reports whether the results of a bake with the options are only a
+// distance texture, which can be packed into channels or an atlas
+func (o Options) Packable() bool {
+	return o.BrickSize == 0 && !o.ADF && !o.Mips && o.Compress == CompressNone && o.Normals == NormalsNone && o.Vectors == VectorsNone &&
+		!o.Triangles && !o.Materials && o.Albedo == AlbedoNone && !o.Occlusion && !o.Curvature
+}
+
+// Settings of calculate for a grid
+func (o Options) settings(width, height, depth int) distanceSettings {
+	settings := distanceSettings{
+		width:             uint16(width),
+		height:            uint16(height),
+		depth:             uint16(depth),
+		convertionOptions: convertionOptions(o.Mirror),
+		threads:           o.Threads,
+		supersample:       o.Supersample,
+		sampling:          o.Sampling,
+	}
+
+	if o.Normals == NormalsAnalytic || o.Vectors != VectorsNone || o.Triangles || o.Materials || o.Albedo != AlbedoNone {
+		settings.convertionOptions |= convertionOptionsTriangles
+	}
+
+	if o.Type == Type16 {
+		settings.convertionOptions |= convertionOptions16bits
+	}
+
+	if o.Units == UnitsTexel {
+		settings.convertionOptions |= convertionOptionsTexelUnits
+	}
+
+	if o.Float32 {
+		settings.convertionOptions |= convertionOptionsFloat32
+	}
+
+	if o.Hybrid {
+		settings.convertionOptions |= convertionOptionsHybrid
+	}
+
+	if o.Sign == SignFloodFill {
+		settings.convertionOptions |= convertionOptionsFloodFill
+	}
+
+	if o.SupersampleFilter == FilterAverage {
+		settings.convertionOptions |= convertionOptionsAverage
+	}
+
+	return settings
+}
+
+var reMirror = regexp.MustCompile(`^(-?x?i?)(-?y?i?)(-?z?i?)$`)
+
+// ParseMirror parses mirror modes (-xi, x, xi) for each axis, like "x-yi"
+func ParseMirror(s string) (Mirror, error) {
+	matches := reMirror.FindStringSubmatch(s)
+	if matches == nil {
+		return 0, fmt.Errorf("invalid mirror mode: \"%s\"", s)
+	}
+
+	var mirror Mirror
+
+	switch matches[1] {
+	case "x":
+		mirror |= MirrorX
+	case "-x":
+		mirror |= MirrorXNegative
+		mirror |= MirrorX
+	case "xi":
+		mirror |= MirrorX
+		mirror |= MirrorXIncludeCenter
+	case "-xi":
+		mirror |= MirrorXNegative
+		mirror |= MirrorX
+		mirror |= MirrorXIncludeCenter
+	}
+
+	switch matches[2] {
+	case "y":
+		mirror |= MirrorY
+	case "-y":
+		mirror |= MirrorYNegative
+		mirror |= MirrorY
+	case "yi":
+		mirror |= MirrorY
+		mirror |= MirrorYIncludeCenter
+	case "-yi":
+		mirror |= MirrorYNegative
+		mirror |= MirrorY
+		mirror |= MirrorYIncludeCenter
+	}
+
+	switch matches[3] {
+	case "z":
+		mirror |= MirrorZ
+	case "-z":
+		mirror |= MirrorZNegative
+		mirror |= MirrorZ
+	case "zi":
+		mirror |= MirrorZ
+		mirror |= MirrorZIncludeCenter
+	case "-zi":
+		mirror |= MirrorZNegative
+		mirror |= MirrorZ
+		mirror |= MirrorZIncludeCenter
+	}
+
+	return mirror, nil
+}
@@ -0,0 +1,298 @@
+package sdf
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Placement of a volume in an atlas, sizes include the padding
+type atlasBox struct {
+	width, height, depth int
+	x, y, z              int
+}
+
+/*
+Places boxes in an atlas, in layers along Z made of rows along Y, tallest boxes
+first so each row and layer wastes little space. The atlas is as wide and high
+as the biggest of the widest box, the highest box and the side of a cube with
+the volume of all the boxes, and as deep as needed, which is returned along
+with the other sizes.
+*/
+func packBoxes(boxes []atlasBox) (width, height, depth int) {
+	volume := 0
+	for _, b := range boxes {
+		width = max(width, b.width)
+		height = max(height, b.height)
+		volume += b.width * b.height * b.depth
+	}
+
+	side := int(math.Ceil(math.Cbrt(float64(volume))))
+	width = max(width, side)
+	height = max(height, side)
+
+	order := make([]int, len(boxes))
+	for i := range order {
+		order[i] = i
+	}
+
+	slices.SortStableFunc(order, func(a, b int) int {
+		if boxes[a].depth != boxes[b].depth {
+			return boxes[b].depth - boxes[a].depth
+		}
+		return boxes[b].height - boxes[a].height
+	})
+
+	x, y, z := 0, 0, 0
+	rowHeight, layerDepth := 0, 0
+	usedHeight := 0
+
+	for _, i := range order {
+		b := &boxes[i]
+
+		if x+b.width > width {
+			x = 0
+			y += rowHeight
+			rowHeight = 0
+		}
+
+		if y+b.height > height {
+			x, y = 0, 0
+			z += layerDepth
+			rowHeight, layerDepth = 0, 0
+		}
+
+		b.x, b.y, b.z = x, y, z
+		x += b.width
+		rowHeight = max(rowHeight, b.height)
+		layerDepth = max(layerDepth, b.depth)
+		usedHeight = max(usedHeight, y+b.height)
+	}
+
+	return width, min(height, usedHeight), z + layerDepth
+}
+
+/*
+Copies a quantized volume of size bytes per texel into an atlas at its box,
+the padding repeats the border texels so filtering at the edges of the volume
+doesn't pick up its neighbours.
+*/
+func blitPadded(atlas []byte, atlasWidth, atlasHeight int, data []byte, width, height, depth, size int, box atlasBox, padding int) {
+	for z := range box.depth {
+		sz := min(max(z-padding, 0), depth-1)
+		for y := range box.height {
+			sy := min(max(y-padding, 0), height-1)
+			for x := range box.width {
+				sx := min(max(x-padding, 0), width-1)
+
+				src := (sx + sy*width + sz*width*height) * size
+				dst := ((box.x + x) + (box.y+y)*atlasWidth + (box.z+z)*atlasWidth*atlasHeight) * size
+				copy(atlas[dst:dst+size], data[src:src+size])
+			}
+		}
+	}
+}
+
+// Checks that results can be packed, all of them only a distance texture of the same type
+func checkPackable(results []*Result) error {
+	if len(results) == 0 {
+		return fmt.Errorf("nothing to pack")
+	}
+
+	for _, r := range results {
+		if !r.options.Packable() || r.Texture.Data == nil {
+			return fmt.Errorf("only encoded distance textures, without bricks, octrees, mips, block compression, normals or companion volumes, can be packed")
+		}
+
+		if r.options.Type != results[0].options.Type || r.options.Units != results[0].options.Units {
+			return fmt.Errorf("packed textures must have the same type and units")
+		}
+	}
+
+	return nil
+}
+
+/*
+PackChannels packs the distance textures of up to four results sharing one
+grid into the channels of one texture, R for the first one, G for the second,
+and so on, each one keeps its range. Two results are packed as RG, three or
+four as RGBA, with an unused alpha for three.
+*/
+func PackChannels(results []*Result) (*Result, error) {
+	if err := checkPackable(results); err != nil {
+		return nil, err
+	}
+
+	if len(results) > 4 {
+		return nil, fmt.Errorf("up to four textures can be packed into the channels of one texture")
+	}
+
+	first := results[0]
+	for _, r := range results {
+		if r.Field.Width != first.Field.Width || r.Field.Height != first.Field.Height || r.Field.Depth != first.Field.Depth ||
+			r.Field.GridMin != first.Field.GridMin || r.Field.GridMax != first.Field.GridMax || r.Field.Sampling != first.Field.Sampling {
+			return nil, fmt.Errorf("textures packed into channels must share the grid")
+		}
+	}
+
+	names := []string{"r", "g", "b", "a"}
+
+	var channels [][]byte
+	var ranges []Range
+	var channelsInfo []map[string]any
+
+	for i, r := range results {
+		channels = append(channels, r.Texture.Data)
+		ranges = append(ranges, Range{r.MinD, r.MaxD})
+		channelsInfo = append(channelsInfo, map[string]any{
+			"channel":               names[i],
+			"distance_min":          r.MinD,
+			"distance_max":          r.MaxD,
+			"distance_clamped":      r.Metadata["distance_clamped"],
+			"mesh_bounding_box_min": r.Mesh.Min,
+			"mesh_bounding_box_max": r.Mesh.Max,
+		})
+	}
+
+	count := 4
+	if len(results) == 2 {
+		count = 2
+	}
+
+	size := int(first.options.Type) / 8
+	bits := int(first.options.Type)
+
+	dxgiFormat := uint32(DXGI_FORMAT_R8G8B8A8_UNORM)
+	switch {
+	case count == 2 && size == 2:
+		dxgiFormat = DXGI_FORMAT_R16G16_UNORM
+	case count == 2:
+		dxgiFormat = DXGI_FORMAT_R8G8_UNORM
+	case size == 2:
+		dxgiFormat = DXGI_FORMAT_R16G16B16A16_UNORM
+	}
+
+	textureFormat := fmt.Sprintf("rgba%d", bits)
+	if count == 2 {
+		textureFormat = fmt.Sprintf("rg%d", bits)
+	}
+
+	return &Result{
+		Mesh:  first.Mesh,
+		Field: DistanceField{Width: first.Field.Width, Height: first.Field.Height, Depth: first.Field.Depth, GridMin: first.Field.GridMin, GridMax: first.Field.GridMax, Sampling: first.Field.Sampling},
+		Texture: Volume{
+			Width:      first.Field.Width,
+			Height:     first.Field.Height,
+			Depth:      first.Field.Depth,
+			Mips:       1,
+			DXGIFormat: dxgiFormat,
+			Data:       interleaveChannels(channels, count, size),
+		},
+		Metadata: map[string]any{
+			"distance_unit":         first.options.Units,
+			"texel_size":            texelSize(first.Field.Width, first.Field.GridMin, first.Field.GridMax, first.Field.Sampling),
+			"texture_width":         first.Field.Width,
+			"texture_height":        first.Field.Height,
+			"texture_depth":         first.Field.Depth,
+			"grid_bounding_box_min": first.Field.GridMin,
+			"grid_bounding_box_max": first.Field.GridMax,
+			"grid_sampling":         first.Field.Sampling,
+			"texture_format":        textureFormat,
+			"mip_count":             1,
+			"channels":              channelsInfo,
+		},
+		options:  first.options,
+		channels: ranges,
+	}, nil
+}
+
+/*
+PackAtlas packs the distance textures of results into one atlas, each one with
+its own grid and range, bin-packed with padding texels around it. The
+"assets" of the metadata say where each one is in the atlas, and how to decode
+its distances, in the order of results.
+*/
+func PackAtlas(results []*Result, padding int) (*Result, error) {
+	if err := checkPackable(results); err != nil {
+		return nil, err
+	}
+
+	if padding < 0 {
+		return nil, fmt.Errorf("padding can't be smaller than zero")
+	}
+
+	boxes := make([]atlasBox, len(results))
+	for i, r := range results {
+		boxes[i] = atlasBox{
+			width:  r.Field.Width + 2*padding,
+			height: r.Field.Height + 2*padding,
+			depth:  r.Field.Depth + 2*padding,
+		}
+	}
+
+	width, height, depth := packBoxes(boxes)
+	logMessage(results[0].options.Progress, "Atlas resolution: %d x %d x %d", width, height, depth)
+
+	if width*height*depth > sizeLimit {
+		return nil, fmt.Errorf("atlas is too big (%d), maximum allowed is %d texels", width*height*depth, sizeLimit)
+	}
+
+	// Unused texels are as far from the surface as possible
+	bits := int(results[0].options.Type)
+	size := bits / 8
+	atlas := make([]byte, width*height*depth*size)
+	for i := range atlas {
+		atlas[i] = 0xFF
+	}
+
+	var assets []map[string]any
+	atlasSize := vec.Vec3{float64(width), float64(height), float64(depth)}
+
+	for i, r := range results {
+		blitPadded(atlas, width, height, r.Texture.Data, r.Field.Width, r.Field.Height, r.Field.Depth, size, boxes[i], padding)
+
+		// First texel of the volume, without the padding
+		offset := vec.Vec3{float64(boxes[i].x + padding), float64(boxes[i].y + padding), float64(boxes[i].z + padding)}
+		volumeSize := vec.Vec3{float64(r.Field.Width), float64(r.Field.Height), float64(r.Field.Depth)}
+
+		assets = append(assets, map[string]any{
+			"atlas_offset":          []int{boxes[i].x + padding, boxes[i].y + padding, boxes[i].z + padding},
+			"atlas_size":            []int{r.Field.Width, r.Field.Height, r.Field.Depth},
+			"atlas_uvw_min":         vec.Mul(offset, vec.Vec3{1.0 / atlasSize[0], 1.0 / atlasSize[1], 1.0 / atlasSize[2]}),
+			"atlas_uvw_max":         vec.Mul(vec.Add(offset, volumeSize), vec.Vec3{1.0 / atlasSize[0], 1.0 / atlasSize[1], 1.0 / atlasSize[2]}),
+			"distance_min":          r.MinD,
+			"distance_max":          r.MaxD,
+			"distance_clamped":      r.Metadata["distance_clamped"],
+			"texel_size":            texelSize(r.Field.Width, r.Field.GridMin, r.Field.GridMax, r.Field.Sampling),
+			"mesh_bounding_box_min": r.Mesh.Min,
+			"mesh_bounding_box_max": r.Mesh.Max,
+			"grid_bounding_box_min": r.Field.GridMin,
+			"grid_bounding_box_max": r.Field.GridMax,
+			"grid_sampling":         r.Field.Sampling,
+		})
+	}
+
+	return &Result{
+		Texture: Volume{
+			Width:  width,
+			Height: height,
+			Depth:  depth,
+			Mips:   1,
+			Bits:   bits,
+			Data:   atlas,
+		},
+		Metadata: map[string]any{
+			"distance_unit":  results[0].options.Units,
+			"texture_width":  width,
+			"texture_height": height,
+			"texture_depth":  depth,
+			"texture_format": fmt.Sprintf("u%d", bits),
+			"mip_count":      1,
+			"atlas_padding":  padding,
+			"assets":         assets,
+		},
+		options: results[0].options,
+	}, nil
+}
@@ -0,0 +1,280 @@
+package sdf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+type plyProperty struct {
+	name      string
+	valueType string
+	countType string // Only for lists
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+// Size in bytes of a PLY scalar type
+func plyTypeSize(t string) int {
+	switch t {
+	case "char", "uchar", "int8", "uint8":
+		return 1
+	case "short", "ushort", "int16", "uint16":
+		return 2
+	case "int", "uint", "int32", "uint32", "float", "float32":
+		return 4
+	case "double", "float64":
+		return 8
+	}
+
+	return 0
+}
+
+// Scale that takes a color of this type to [0, 1]
+func plyColorScale(t string) float64 {
+	switch t {
+	case "uchar", "uint8":
+		return 1.0 / 255.0
+	case "ushort", "uint16":
+		return 1.0 / 65535.0
+	}
+
+	return 1.0
+}
+
+// LoadPLY loads a mesh from a PLY file.
+func LoadPLY(path string) (*Mesh, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPLY(file)
+}
+
+// ReadPLY reads a mesh in the PLY format, ASCII or binary.
+// It parses the vertices, their colors if they have red, green and blue
+// properties, and triangular faces, and calculates the bounding box.
+func ReadPLY(r io.Reader) (*Mesh, error) {
+	reader := bufio.NewReader(r)
+	format := ""
+	var elements []*plyElement
+
+	for header := 0; ; header++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("unexpected end of PLY header: %w", err)
+		}
+
+		tokens := strings.Fields(line)
+		if header == 0 {
+			if len(tokens) != 1 || tokens[0] != "ply" {
+				return nil, fmt.Errorf("not a PLY file")
+			}
+			continue
+		}
+
+		if len(tokens) == 0 {
+			continue
+		}
+
+		if tokens[0] == "end_header" {
+			break
+		}
+
+		switch tokens[0] {
+		case "format":
+			if len(tokens) != 3 {
+				return nil, fmt.Errorf("invalid PLY format: %s", line)
+			}
+			format = tokens[1]
+
+		case "element":
+			if len(tokens) != 3 {
+				return nil, fmt.Errorf("invalid PLY element: %s", line)
+			}
+
+			count, err := strconv.Atoi(tokens[2])
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, &plyElement{name: tokens[1], count: count})
+
+		case "property":
+			if len(elements) == 0 {
+				return nil, fmt.Errorf("PLY property before any element: %s", line)
+			}
+
+			element := elements[len(elements)-1]
+			if len(tokens) == 5 && tokens[1] == "list" {
+				element.properties = append(element.properties, plyProperty{name: tokens[4], valueType: tokens[3], countType: tokens[2]})
+			} else if len(tokens) == 3 {
+				element.properties = append(element.properties, plyProperty{name: tokens[2], valueType: tokens[1]})
+			} else {
+				return nil, fmt.Errorf("invalid PLY property: %s", line)
+			}
+		}
+	}
+
+	var readValue func(valueType string) (float64, error)
+
+	switch format {
+	case "ascii":
+		words := bufio.NewScanner(reader)
+		words.Split(bufio.ScanWords)
+
+		readValue = func(string) (float64, error) {
+			if !words.Scan() {
+				if err := words.Err(); err != nil {
+					return 0, err
+				}
+				return 0, io.ErrUnexpectedEOF
+			}
+			return strconv.ParseFloat(words.Text(), 64)
+		}
+
+	case "binary_little_endian", "binary_big_endian":
+		var order binary.ByteOrder = binary.LittleEndian
+		if format == "binary_big_endian" {
+			order = binary.BigEndian
+		}
+
+		var buffer [8]byte
+		readValue = func(valueType string) (float64, error) {
+			size := plyTypeSize(valueType)
+			if size == 0 {
+				return 0, fmt.Errorf("unknown PLY type: %s", valueType)
+			}
+
+			b := buffer[:size]
+			if _, err := io.ReadFull(reader, b); err != nil {
+				return 0, err
+			}
+
+			switch valueType {
+			case "char", "int8":
+				return float64(int8(b[0])), nil
+			case "uchar", "uint8":
+				return float64(b[0]), nil
+			case "short", "int16":
+				return float64(int16(order.Uint16(b))), nil
+			case "ushort", "uint16":
+				return float64(order.Uint16(b)), nil
+			case "int", "int32":
+				return float64(int32(order.Uint32(b))), nil
+			case "uint", "uint32":
+				return float64(order.Uint32(b)), nil
+			case "float", "float32":
+				return float64(math.Float32frombits(order.Uint32(b))), nil
+			}
+			return math.Float64frombits(order.Uint64(b)), nil
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported PLY format: %s", format)
+	}
+
+	model := &Mesh{
+		Min: vec.Vec3{posBigfloat64, posBigfloat64, posBigfloat64},
+		Max: vec.Vec3{negBigfloat64, negBigfloat64, negBigfloat64},
+	}
+	hasColors := false
+
+	for _, element := range elements {
+		for range element.count {
+			var vertex vec.Vec3
+			color := vec.Vec3{1.0, 1.0, 1.0}
+			var indices []float64
+
+			for _, property := range element.properties {
+				if property.countType != "" {
+					count, err := readValue(property.countType)
+					if err != nil {
+						return nil, err
+					}
+
+					values := make([]float64, int(count))
+					for i := range values {
+						if values[i], err = readValue(property.valueType); err != nil {
+							return nil, err
+						}
+					}
+
+					if property.name == "vertex_indices" || property.name == "vertex_index" {
+						indices = values
+					}
+					continue
+				}
+
+				v, err := readValue(property.valueType)
+				if err != nil {
+					return nil, err
+				}
+
+				switch property.name {
+				case "x":
+					vertex[0] = v
+				case "y":
+					vertex[1] = v
+				case "z":
+					vertex[2] = v
+				case "red":
+					color[0] = v * plyColorScale(property.valueType)
+					hasColors = true
+				case "green":
+					color[1] = v * plyColorScale(property.valueType)
+				case "blue":
+					color[2] = v * plyColorScale(property.valueType)
+				}
+			}
+
+			switch element.name {
+			case "vertex":
+				model.Vertices = append(model.Vertices, vertex)
+				model.Colors = append(model.Colors, color)
+
+				for i := range 3 {
+					model.Min[i] = min(model.Min[i], vertex[i])
+					model.Max[i] = max(model.Max[i], vertex[i])
+				}
+
+			case "face":
+				if len(indices) != 3 {
+					return nil, fmt.Errorf("only triangular faces supported, found a face with %d vertices", len(indices))
+				}
+
+				model.Triangles = append(model.Triangles, Triangle{uint32(indices[0]), uint32(indices[1]), uint32(indices[2])})
+			}
+		}
+	}
+
+	for _, triangle := range model.Triangles {
+		for _, v := range triangle {
+			if int(v) >= len(model.Vertices) {
+				return nil, fmt.Errorf("vertex index out of range: %d", v)
+			}
+		}
+	}
+
+	if err := checkWatertight(model.Triangles); err != nil {
+		return nil, err
+	}
+
+	if !hasColors {
+		model.Colors = nil
+	}
+
+	return model, nil
+}
@@ -0,0 +1,83 @@
+package sdf
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+Runs work for every tile from 0 to tiles-1 on a pool of threads workers
+(GOMAXPROCS when zero), which pull the next tile when they're done with one.
+worker goes from 0 to the number of workers, so each one can keep its own
+scratch memory. No more tiles are handed out once ctx is done.
+*/
+func runPool(ctx context.Context, threads, tiles int, work func(worker, tile int)) {
+	threads = poolSize(threads, tiles)
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+
+	for worker := range threads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				tile := int(next.Add(1) - 1)
+				if tile >= tiles {
+					return
+				}
+
+				work(worker, tile)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Number of workers runPool uses
+func poolSize(threads, tiles int) int {
+	if threads <= 0 {
+		threads = runtime.GOMAXPROCS(0)
+	}
+
+	return max(min(threads, tiles), 0)
+}
+
+/*
+Set of the triangles visited by one search. Each search stamps the triangles
+with a new generation instead of clearing the set, so a worker can reuse it
+for all its searches without allocating.
+*/
+type visitedSet struct {
+	stamps     []uint32
+	generation uint32
+}
+
+func newVisitedSet(triangles int) *visitedSet {
+	return &visitedSet{stamps: make([]uint32, triangles)}
+}
+
+// Starts a new search, with no triangle visited
+func (v *visitedSet) reset() {
+	v.generation++
+
+	// Only after 4 billion searches
+	if v.generation == 0 {
+		clear(v.stamps)
+		v.generation = 1
+	}
+}
+
+// Marks a triangle as visited, returns false if it already was
+func (v *visitedSet) visit(triangle int) bool {
+	if v.stamps[triangle] == v.generation {
+		return false
+	}
+
+	v.stamps[triangle] = v.generation
+	return true
+}
@@ -0,0 +1,122 @@
+package sdf
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Progress receives how much of each long stage of a bake is done
+type Progress interface {
+	// Progress is called with done going from 0 to total for each stage,
+	// never from more than one goroutine at once
+	Progress(stage string, done, total int)
+}
+
+// ProgressFunc lets a function be used as a Progress
+type ProgressFunc func(stage string, done, total int)
+
+func (f ProgressFunc) Progress(stage string, done, total int) {
+	f(stage, done, total)
+}
+
+/*
+Logger is a Progress that also receives the messages of a bake. When the
+Progress of the options is a Logger the messages go to it, otherwise they're
+dropped. Like Progress, it's never called from more than one goroutine at once.
+*/
+type Logger interface {
+	Progress
+
+	// Message is an informative line, like the output resolution
+	Message(text string)
+
+	// Warning is something wrong with the mesh or the result, triangle is the
+	// index of the triangle it's about, or -1
+	Warning(text string, triangle int)
+}
+
+// Warning of a mesh loader, kept in the mesh until someone logs it
+type Warning struct {
+	Text     string
+	Triangle int // -1 when it's not about a triangle
+}
+
+// StdoutLogger prints the messages, and the percentage done of each stage, on stdout
+type StdoutLogger struct {
+	percent int
+}
+
+func (l *StdoutLogger) Progress(stage string, done, total int) {
+	if done == 0 {
+		fmt.Printf("%s:\n", stage)
+		l.percent = -1
+	}
+
+	percent := done * 100 / max(total, 1)
+	if percent == l.percent {
+		return
+	}
+	l.percent = percent
+
+	if done == total {
+		fmt.Println("\r100%")
+	} else {
+		fmt.Printf("\r%d%%", percent)
+	}
+}
+
+func (l *StdoutLogger) Message(text string) {
+	fmt.Println(text)
+}
+
+func (l *StdoutLogger) Warning(text string, triangle int) {
+	if triangle >= 0 {
+		fmt.Printf("Warning: %s (triangle %d)\n", text, triangle)
+	} else {
+		fmt.Println("Warning:", text)
+	}
+}
+
+// Logs a message, when progress is a Logger
+func logMessage(progress Progress, format string, args ...any) {
+	if logger, ok := progress.(Logger); ok {
+		logger.Message(fmt.Sprintf(format, args...))
+	}
+}
+
+// Logs a warning, when progress is a Logger
+func logWarning(progress Progress, triangle int, format string, args ...any) {
+	if logger, ok := progress.(Logger); ok {
+		logger.Warning(fmt.Sprintf(format, args...), triangle)
+	}
+}
+
+// Counts the progress of a stage done by several goroutines
+type stageProgress struct {
+	mu       sync.Mutex
+	progress Progress
+	stage    string
+	done     int
+	total    int
+}
+
+// Starts a stage of total steps, progress can be nil
+func startStage(progress Progress, stage string, total int) *stageProgress {
+	if progress != nil {
+		progress.Progress(stage, 0, total)
+	}
+
+	return &stageProgress{progress: progress, stage: stage, total: total}
+}
+
+// Adds n finished steps, nothing is reported when n is zero
+func (s *stageProgress) add(n int) {
+	if s.progress == nil || n == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.done += n
+	s.progress.Progress(s.stage, s.done, s.total)
+	s.mu.Unlock()
+}
@@ -0,0 +1,349 @@
+package sdf
+
+import (
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+/*
+Everything distance() derives from the vertices of a triangle, calculated once
+per triangle instead of once per texel and triangle. Stored as one slice per
+component, so the kernel reads a few contiguous arrays. T is float64, or
+float32 for a faster but less precise kernel.
+*/
+type triangleRecords[T ~float32 | ~float64] struct {
+	// Vertex a
+	ax, ay, az []T
+
+	// Edges b - a, c - b and a - c
+	bax, bay, baz []T
+	cbx, cby, cbz []T
+	acx, acy, acz []T
+
+	// Inverse of the squared length of each edge
+	invBA, invCB, invAC []T
+
+	// Unit normal, and its dot product with the centroid, the plane used for the sign
+	nx, ny, nz, nd []T
+
+	// Normals of the edges, in the plane of the triangle
+	e0x, e0y, e0z []T
+	e1x, e1y, e1z []T
+	e2x, e2y, e2z []T
+}
+
+func newTriangleRecords[T ~float32 | ~float64](mesh Mesh) *triangleRecords[T] {
+	n := len(mesh.Triangles)
+	alloc := func() []T { return make([]T, n) }
+
+	r := &triangleRecords[T]{
+		ax: alloc(), ay: alloc(), az: alloc(),
+		bax: alloc(), bay: alloc(), baz: alloc(),
+		cbx: alloc(), cby: alloc(), cbz: alloc(),
+		acx: alloc(), acy: alloc(), acz: alloc(),
+		invBA: alloc(), invCB: alloc(), invAC: alloc(),
+		nx: alloc(), ny: alloc(), nz: alloc(), nd: alloc(),
+		e0x: alloc(), e0y: alloc(), e0z: alloc(),
+		e1x: alloc(), e1y: alloc(), e1z: alloc(),
+		e2x: alloc(), e2y: alloc(), e2z: alloc(),
+	}
+
+	for i, triangle := range mesh.Triangles {
+		a := mesh.Vertices[triangle[0]]
+		b := mesh.Vertices[triangle[1]]
+		c := mesh.Vertices[triangle[2]]
+
+		ba := vec.Sub(b, a)
+		cb := vec.Sub(c, b)
+		ac := vec.Sub(a, c)
+		n := vec.Cross(ba, ac)
+		e0 := vec.Cross(ba, n)
+		e1 := vec.Cross(cb, n)
+		e2 := vec.Cross(ac, n)
+
+		// Degenerate triangles keep a zero normal, so they have no distance, and
+		// are only the closest when no other triangle is found
+		unit := vec.Vec3{}
+		if vec.Dot2(n) > 0.0 {
+			unit = vec.Normalize(n)
+		}
+		centroid := vec.Scale(vec.Add(vec.Add(b, c), a), 1.0/3.0)
+
+		r.ax[i], r.ay[i], r.az[i] = T(a[0]), T(a[1]), T(a[2])
+		r.bax[i], r.bay[i], r.baz[i] = T(ba[0]), T(ba[1]), T(ba[2])
+		r.cbx[i], r.cby[i], r.cbz[i] = T(cb[0]), T(cb[1]), T(cb[2])
+		r.acx[i], r.acy[i], r.acz[i] = T(ac[0]), T(ac[1]), T(ac[2])
+		r.invBA[i] = T(inverseLength2(ba))
+		r.invCB[i] = T(inverseLength2(cb))
+		r.invAC[i] = T(inverseLength2(ac))
+		r.nx[i], r.ny[i], r.nz[i] = T(unit[0]), T(unit[1]), T(unit[2])
+		r.nd[i] = T(vec.Dot(unit, centroid))
+		r.e0x[i], r.e0y[i], r.e0z[i] = T(e0[0]), T(e0[1]), T(e0[2])
+		r.e1x[i], r.e1y[i], r.e1z[i] = T(e1[0]), T(e1[1]), T(e1[2])
+		r.e2x[i], r.e2y[i], r.e2z[i] = T(e2[0]), T(e2[1]), T(e2[2])
+	}
+
+	return r
+}
+
+// Inverse of the squared length of an edge, zero for an edge of zero length,
+// so its closest point is its first vertex instead of NaN
+func inverseLength2(edge vec.Vec3) float64 {
+	l := vec.Dot2(edge)
+	if l == 0.0 {
+		return 0.0
+	}
+
+	return 1.0 / l
+}
+
+// Sign of a value, as an integer
+func signum[T ~float32 | ~float64](v T) int {
+	if v > 0 {
+		return 1
+	}
+	if v < 0 {
+		return -1
+	}
+	return 0
+}
+
+/*
+Signed distance from point p to triangle i, the same as distance() with the
+vertices of the triangle, up to rounding. posBigfloat64 for degenerate triangles,
+or points on the plane through the centroid.
+*/
+func (r *triangleRecords[T]) distance(i int, px, py, pz T) float64 {
+	t := r.nx[i]*px + r.ny[i]*py + r.nz[i]*pz - r.nd[i]
+	if t == 0.0 {
+		return posBigfloat64
+	}
+
+	sign := T(1.0)
+	if t > 0.0 {
+		sign = -1.0
+	}
+
+	pax := px - r.ax[i]
+	pay := py - r.ay[i]
+	paz := pz - r.az[i]
+
+	// Each edge is tested against p minus one of its own vertices
+	pbx, pby, pbz := pax-r.bax[i], pay-r.bay[i], paz-r.baz[i]
+	pcx, pcy, pcz := pax+r.acx[i], pay+r.acy[i], paz+r.acz[i]
+
+	if signum(r.e0x[i]*pax+r.e0y[i]*pay+r.e0z[i]*paz)+
+		signum(r.e1x[i]*pbx+r.e1y[i]*pby+r.e1z[i]*pbz)+
+		signum(r.e2x[i]*pcx+r.e2y[i]*pcy+r.e2z[i]*pcz) < 2 {
+		return float64(sign) * math.Sqrt(float64(r.edgeDistance2(i, pax, pay, paz)))
+	}
+
+	plane := r.nx[i]*pax + r.ny[i]*pay + r.nz[i]*paz
+	if plane < 0.0 {
+		plane = -plane
+	}
+
+	return float64(sign * plane)
+}
+
+// Squared distance from p to the closest edge of triangle i, with pa = p - a
+func (r *triangleRecords[T]) edgeDistance2(i int, pax, pay, paz T) T {
+	bax, bay, baz := r.bax[i], r.bay[i], r.baz[i]
+	cbx, cby, cbz := r.cbx[i], r.cby[i], r.cbz[i]
+	acx, acy, acz := r.acx[i], r.acy[i], r.acz[i]
+
+	// p - b and p - c
+	pbx, pby, pbz := pax-bax, pay-bay, paz-baz
+	pcx, pcy, pcz := pax+acx, pay+acy, paz+acz
+
+	h := vec.Saturate((bax*pax + bay*pay + baz*paz) * r.invBA[i])
+	dx, dy, dz := bax*h-pax, bay*h-pay, baz*h-paz
+	d := dx*dx + dy*dy + dz*dz
+
+	h = vec.Saturate((cbx*pbx + cby*pby + cbz*pbz) * r.invCB[i])
+	dx, dy, dz = cbx*h-pbx, cby*h-pby, cbz*h-pbz
+	d = min(d, dx*dx+dy*dy+dz*dz)
+
+	h = vec.Saturate((acx*pcx + acy*pcy + acz*pcz) * r.invAC[i])
+	dx, dy, dz = acx*h-pcx, acy*h-pcy, acz*h-pcz
+	return min(d, dx*dx+dy*dy+dz*dz)
+}
+
+/*
+Signed distance from point p to closest point on mesh, and the index of the
+closest triangle, using triangle lists to accelerate search. cellSize is the
+smallest distance between the cells of the lists. visited is the scratch set of
+the caller, it can't be shared with other goroutines. When none of the
+triangles searched has a distance, like when they're all degenerate, the
+closest one by its edges is returned, with that positive distance, so the index
+is always a triangle of the mesh.
+*/
+func (r *triangleRecords[T]) closestUsingList(p vec.Vec3, width, height, depth, ix, iy, iz int, triangleLists [][]int, cellSize float64, visited *visitedSet) (float64, int) {
+	minDistance := posBigfloat64
+	closestTriangle := -1
+	px, py, pz := T(p[0]), T(p[1]), T(p[2])
+
+	// Squared distance to the edges of the closest triangle without a distance
+	fallbackDistance := T(math.Inf(1))
+	fallbackTriangle := -1
+
+	processTriangle := func(triangleIdx int) {
+		// The distance to the plane of a triangle is never more than the
+		// distance to the triangle, so it can skip the edges of the far ones
+		if closestTriangle != -1 {
+			plane := r.nx[triangleIdx]*(px-r.ax[triangleIdx]) + r.ny[triangleIdx]*(py-r.ay[triangleIdx]) + r.nz[triangleIdx]*(pz-r.az[triangleIdx])
+			if math.Abs(float64(plane)) >= math.Abs(minDistance) {
+				return
+			}
+		}
+
+		d := r.distance(triangleIdx, px, py, pz)
+
+		if d == posBigfloat64 {
+			e := r.edgeDistance2(triangleIdx, px-r.ax[triangleIdx], py-r.ay[triangleIdx], pz-r.az[triangleIdx])
+			if fallbackTriangle == -1 || e < fallbackDistance {
+				fallbackDistance = e
+				fallbackTriangle = triangleIdx
+			}
+			return
+		}
+
+		if math.Abs(d) < math.Abs(minDistance) {
+			minDistance = d
+			closestTriangle = triangleIdx
+		}
+	}
+
+	if triangleLists == nil {
+		for i := range r.ax {
+			processTriangle(i)
+			if minDistance == 0.0 {
+				return 0.0, closestTriangle
+			}
+		}
+	} else {
+		visited.reset()
+
+		// The closest triangle of a layer isn't always the closest one. A
+		// triangle is in the cell nearest to its closest point to p, and p is
+		// within half a cell of ix, iy, iz, so a closer triangle is in a cell
+		// whose offset, less a cell in each axis, is shorter than the distance
+		// found. Layers are searched while they have such cells, and only
+		// those cells, until every triangle is visited.
+		searched := 0
+		searchCell := func(x, y, z int) bool {
+			for _, triangleIdx := range triangleLists[x+y*width+z*width*height] {
+				// skip triangle if already visited, and set it as visited
+				if !visited.visit(triangleIdx) {
+					continue
+				}
+				searched++
+
+				processTriangle(triangleIdx)
+				if minDistance == 0.0 {
+					return true
+				}
+			}
+			return false
+		}
+
+		// Squared distance, in cells, from p to the triangles of the cells at
+		// an offset in one axis, at least
+		gap2 := func(offset int) float64 {
+			g := float64(max(0, offset-1, -offset-1))
+			return g * g
+		}
+
+		// Largest offset in one axis, up to the layer, of the cells with a gap
+		// shorter than reach, -1 when there are none
+		span := func(reach float64, layer int) int {
+			if reach <= 0.0 {
+				return -1
+			}
+			return int(min(float64(layer), math.Ceil(math.Sqrt(reach))))
+		}
+
+		extent := vec.Max(vec.Max3(ix, iy, iz), vec.Max3(width-1-ix, height-1-iy, depth-1-iz))
+		for layer := 0; layer <= extent && searched < len(r.ax); layer++ {
+			// Squared distance found, in cells, infinite until there's one
+			reach := math.Inf(1)
+			if closestTriangle != -1 {
+				reach = minDistance * minDistance / (cellSize * cellSize)
+			}
+			if span(reach, layer) < layer {
+				break
+			}
+
+			// With fewer triangles left than cells in the layer it's faster to
+			// search all of them
+			if shell := (2*layer+1)*(2*layer+1)*(2*layer+1) - (2*layer-1)*(2*layer-1)*(2*layer-1); layer > 0 && len(r.ax)-searched <= shell {
+				for triangleIdx := range r.ax {
+					if !visited.visit(triangleIdx) {
+						continue
+					}
+
+					processTriangle(triangleIdx)
+					if minDistance == 0.0 {
+						return 0.0, closestTriangle
+					}
+				}
+				break
+			}
+
+			for zz := vec.Max(0, iz-layer); zz <= vec.Min(iz+layer, depth-1); zz++ {
+				reachZ := reach - gap2(zz-iz)
+				yr := span(reachZ, layer)
+
+				for yy := vec.Max(0, iy-yr); yy <= vec.Min(iy+yr, height-1); yy++ {
+					xr := span(reachZ-gap2(yy-iy), layer)
+
+					// Only the shell of the layer, its inside was searched before
+					if zz == iz-layer || zz == iz+layer || yy == iy-layer || yy == iy+layer {
+						for xx := vec.Max(0, ix-xr); xx <= vec.Min(ix+xr, width-1); xx++ {
+							if searchCell(xx, yy, zz) {
+								return 0.0, closestTriangle
+							}
+						}
+					} else if xr == layer {
+						if ix-layer >= 0 && searchCell(ix-layer, yy, zz) {
+							return 0.0, closestTriangle
+						}
+						if ix+layer < width && searchCell(ix+layer, yy, zz) {
+							return 0.0, closestTriangle
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if closestTriangle == -1 && fallbackTriangle != -1 {
+		return math.Sqrt(float64(fallbackDistance)), fallbackTriangle
+	}
+
+	return minDistance, closestTriangle
+}
+
+/*
+Signed distance from point p to closest point on mesh, using triangle lists to accelerate search
+*/
+func (r *triangleRecords[T]) distanceUsingList(p vec.Vec3, width, height, depth, ix, iy, iz int, triangleLists [][]int, cellSize float64, visited *visitedSet) float64 {
+	d, _ := r.closestUsingList(p, width, height, depth, ix, iy, iz, triangleLists, cellSize, visited)
+	return d
+}
+
+// Searches the closest triangle to a point, with the records in either precision
+type triangleSearch interface {
+	closestUsingList(p vec.Vec3, width, height, depth, ix, iy, iz int, triangleLists [][]int, cellSize float64, visited *visitedSet) (float64, int)
+	distanceUsingList(p vec.Vec3, width, height, depth, ix, iy, iz int, triangleLists [][]int, cellSize float64, visited *visitedSet) float64
+}
+
+// Precomputes the triangle records of a mesh, in float32 when asked to
+func newTriangleSearch(mesh Mesh, float32Kernel bool) triangleSearch {
+	if float32Kernel {
+		return newTriangleRecords[float32](mesh)
+	}
+
+	return newTriangleRecords[float64](mesh)
+}
@@ -0,0 +1,133 @@
+package sdf
+
+import (
+	"context"
+	"math"
+)
+
+/*
+Fills the texels far from the surface, the ones set to +Inf, solving the
+eikonal equation |grad d| = 1 with the fast sweeping method (Zhao 2005),
+starting from the exact distances of the other texels, h is the size of a
+texel. The exact texels stop a flood fill of the exterior from the border of
+the grid, far texels it doesn't reach are inside, and get negative distances.
+Returns the number of exact texels, or the error of ctx when it's done before
+finishing, checking once per slice.
+*/
+func sweepFarField(ctx context.Context, data []float64, width, height, depth int, h float64, progress Progress) (int, error) {
+	far := make([]bool, len(data))
+	exact := 0
+	for i, d := range data {
+		far[i] = math.IsInf(d, 1)
+		if !far[i] {
+			exact++
+		}
+	}
+
+	// Sweeping works on unsigned distances
+	u := make([]float64, len(data))
+	for i, d := range data {
+		u[i] = math.Abs(d)
+	}
+
+	// Neighbour with the smallest distance along one axis, +Inf when there's none
+	smallest := func(i, c, size, stride int) float64 {
+		n := math.Inf(1)
+		if c > 0 {
+			n = u[i-stride]
+		}
+		if c < size-1 {
+			n = min(n, u[i+stride])
+		}
+		return n
+	}
+
+	// One step per slice of each of the 8 sweeps
+	stage := startStage(progress, "Sweeping far field", 8*depth)
+
+	for sweep := range 8 {
+		for zi := range depth {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+
+			z := zi
+			if sweep&4 != 0 {
+				z = depth - 1 - zi
+			}
+
+			for yi := range height {
+				y := yi
+				if sweep&2 != 0 {
+					y = height - 1 - yi
+				}
+
+				for xi := range width {
+					x := xi
+					if sweep&1 != 0 {
+						x = width - 1 - xi
+					}
+
+					i := x + y*width + z*width*height
+					if !far[i] {
+						continue
+					}
+
+					a := smallest(i, x, width, 1)
+					b := smallest(i, y, height, width)
+					c := smallest(i, z, depth, width*height)
+
+					// Sorted, a <= b <= c
+					if a > b {
+						a, b = b, a
+					}
+					if b > c {
+						b, c = c, b
+					}
+					if a > b {
+						a, b = b, a
+					}
+
+					u[i] = min(u[i], eikonalUpdate(a, b, c, h))
+				}
+			}
+
+			stage.add(1)
+		}
+	}
+
+	exterior := floodExterior(width, height, depth, far)
+	for i := range data {
+		if !far[i] {
+			continue
+		}
+
+		if exterior[i] {
+			data[i] = u[i]
+		} else {
+			data[i] = -u[i]
+		}
+	}
+
+	return exact, nil
+}
+
+/*
+Distance of a texel from the distances a <= b <= c of its closest neighbours
+along each axis, the Godunov upwind solution of |grad d| = 1 with texels of
+size h. +Inf when a is.
+*/
+func eikonalUpdate(a, b, c, h float64) float64 {
+	d := a + h
+	if d <= b {
+		return d
+	}
+
+	d = (a + b + math.Sqrt(2.0*h*h-(a-b)*(a-b))) * 0.5
+	if d <= c {
+		return d
+	}
+
+	s := a + b + c
+	return (s + math.Sqrt(max(s*s-3.0*(a*a+b*b+c*c-h*h), 0.0))) / 3.0
+}
@@ -0,0 +1,181 @@
+package sdf
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Material from a .mtl file, only what's needed for the color volume
+type Material struct {
+	Diffuse    vec.Vec3 // Kd
+	DiffuseMap string   // map_Kd, relative to the OBJ file
+}
+
+// loadMTL loads the materials of an MTL file, by name.
+func loadMTL(open Opener, name string) (map[string]Material, error) {
+	file, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	dir := filepath.Dir(name)
+	name = ""
+
+	materials := map[string]Material{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens := strings.Fields(scanner.Text())
+		if len(tokens) == 0 || strings.HasPrefix(tokens[0], "#") {
+			continue
+		}
+
+		switch tokens[0] {
+		case "newmtl":
+			name = strings.Join(tokens[1:], " ")
+			materials[name] = Material{Diffuse: vec.Vec3{1.0, 1.0, 1.0}}
+
+		case "Kd":
+			if len(tokens) < 4 {
+				return nil, fmt.Errorf("unexpected number of values: %s", scanner.Text())
+			}
+
+			material := materials[name]
+			for i := range 3 {
+				material.Diffuse[i], _ = strconv.ParseFloat(tokens[i+1], 64)
+			}
+			materials[name] = material
+
+		case "map_Kd":
+			// Options go before the file name, so it's the last token
+			if len(tokens) < 2 {
+				continue
+			}
+
+			material := materials[name]
+			material.DiffuseMap = filepath.Join(dir, tokens[len(tokens)-1])
+			materials[name] = material
+		}
+	}
+
+	return materials, scanner.Err()
+}
+
+func loadImage(open Opener, name string) (image.Image, error) {
+	file, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// Bilinear sample with repeat wrapping, v goes up like in OBJ files, returns RGBA in [0, 1]
+func sampleBilinear(img image.Image, u, v float64) [4]float64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Texel centers are at half texels
+	x := (u-math.Floor(u))*float64(w) - 0.5
+	y := (1.0-(v-math.Floor(v)))*float64(h) - 0.5
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+
+	texel := func(x, y int) [4]float64 {
+		x = ((x % w) + w) % w
+		y = ((y % h) + h) % h
+		r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+
+		// Colors are alpha premultiplied
+		if a == 0 {
+			return [4]float64{}
+		}
+		return [4]float64{float64(r) / float64(a), float64(g) / float64(a), float64(b) / float64(a), float64(a) / 65535.0}
+	}
+
+	c00 := texel(int(x0), int(y0))
+	c10 := texel(int(x0)+1, int(y0))
+	c01 := texel(int(x0), int(y0)+1)
+	c11 := texel(int(x0)+1, int(y0)+1)
+
+	var c [4]float64
+	for i := range 4 {
+		top := c00[i] + (c10[i]-c00[i])*fx
+		bottom := c01[i] + (c11[i]-c01[i])*fx
+		c[i] = top + (bottom-top)*fy
+	}
+
+	return c
+}
+
+/*
+Color at the closest point of each texel, from the map_Kd texture of the
+material of the closest triangle, or its Kd color when it has no texture or
+texture coordinates. Returns RGBA8 texels. Needs the closest triangle of each texel.
+*/
+func textureColors(mesh Mesh, field DistanceField, progress Progress) ([]byte, error) {
+	if mesh.MaterialsFromGroups || len(mesh.Materials) == 0 {
+		return nil, fmt.Errorf("the mesh has no usemtl statements")
+	}
+
+	// Load each texture once
+	images := make([]image.Image, len(mesh.Materials))
+	for i, name := range mesh.Materials {
+		material, ok := mesh.MaterialLibrary[name]
+		if !ok {
+			logWarning(progress, -1, "material \"%s\" not found in the material libraries", name)
+			continue
+		}
+
+		if material.DiffuseMap == "" || mesh.open == nil {
+			continue
+		}
+
+		img, err := loadImage(mesh.open, material.DiffuseMap)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = img
+	}
+
+	_, barycentrics := closestPoints(mesh, field)
+	out := make([]byte, len(field.Data)*4)
+
+	for i, triangleIdx := range field.Triangles {
+		materialIdx := mesh.TriangleMaterials[triangleIdx]
+		texCoords := mesh.TriangleTexCoords[triangleIdx]
+
+		color := [4]float64{1.0, 1.0, 1.0, 1.0}
+		if material, ok := mesh.MaterialLibrary[mesh.Materials[materialIdx]]; ok {
+			color = [4]float64{material.Diffuse[0], material.Diffuse[1], material.Diffuse[2], 1.0}
+		}
+
+		if img := images[materialIdx]; img != nil && texCoords[0] != noTexCoord && texCoords[1] != noTexCoord && texCoords[2] != noTexCoord {
+			var uv [2]float64
+			for j := range 3 {
+				uv[0] += mesh.TexCoords[texCoords[j]][0] * barycentrics[i][j]
+				uv[1] += mesh.TexCoords[texCoords[j]][1] * barycentrics[i][j]
+			}
+
+			color = sampleBilinear(img, uv[0], uv[1])
+		}
+
+		for c := range 4 {
+			putUnorm(out[i*4+c:], color[c], 8)
+		}
+	}
+
+	return out, nil
+}
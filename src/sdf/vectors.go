@@ -0,0 +1,114 @@
+package sdf
+
+import (
+	"math"
+
+	"github.com/xernobyl/mesh2distance/src/vec"
+)
+
+// Vector from each texel to its closest point on the mesh, needs the closest triangle of each texel
+func closestVectors(mesh Mesh, field DistanceField) []vec.Vec3 {
+	vectors, _ := closestPoints(mesh, field)
+
+	for z := range field.Depth {
+		for y := range field.Height {
+			for x := range field.Width {
+				i := x + y*field.Width + z*field.Width*field.Height
+				vectors[i] = vec.Sub(vectors[i], field.position(x, y, z))
+			}
+		}
+	}
+
+	return vectors
+}
+
+// Converts to a IEEE 754 half precision float, rounding to nearest
+func float16(v float64) uint16 {
+	bits := math.Float32bits(float32(v))
+	sign := uint16(bits>>16) & 0x8000
+	exp := int((bits>>23)&0xFF) - 127 + 15
+	mantissa := bits & 0x7FFFFF
+
+	switch {
+	case (bits>>23)&0xFF == 0xFF:
+		// Infinity or NaN
+		if mantissa != 0 {
+			return sign | 0x7E00
+		}
+		return sign | 0x7C00
+	case exp >= 31:
+		// Too big, infinity
+		return sign | 0x7C00
+	case exp <= 0:
+		// Subnormal or zero
+		if exp < -10 {
+			return sign
+		}
+
+		mantissa |= 0x800000
+		shift := uint(14 - exp)
+		half := mantissa >> shift
+		if (mantissa>>(shift-1))&1 != 0 {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	// A carry out of the mantissa correctly bumps the exponent
+	half := sign | uint16(exp<<10) | uint16(mantissa>>13)
+	if mantissa&0x1000 != 0 {
+		half++
+	}
+
+	return half
+}
+
+// Stores a value in [-1, 1] as an 8 or 16 bits signed normalized integer, little endian
+func putSnorm(out []byte, v float64, bits int) {
+	v = vec.Clamp(v, -1.0, 1.0)
+
+	if bits == 16 {
+		t := uint16(int16(math.Round(v * 32767.0)))
+		out[0] = byte(t & 0xFF)
+		out[1] = byte((t >> 8) & 0xFF)
+	} else {
+		out[0] = byte(int8(math.Round(v * 127.0)))
+	}
+}
+
+/*
+Packs the vectors in RGB, and the sign of the distance (1 or -1) in A when
+withSign is set, 0 otherwise. Formats are half floats (bits 0), or 8 or 16
+bits signed normalized integers, where the vectors are divided by scale.
+*/
+func packVectors(vectors []vec.Vec3, distances []float64, withSign bool, bits int, scale float64) []byte {
+	size := 2
+	if bits == 8 {
+		size = 1
+	}
+
+	out := make([]byte, len(vectors)*4*size)
+
+	for i, v := range vectors {
+		texel := out[i*4*size:]
+		channels := [4]float64{v[0], v[1], v[2], 0.0}
+		if withSign {
+			channels[3] = signNotZero(distances[i])
+		}
+
+		for c, value := range channels {
+			if bits == 0 {
+				h := float16(value)
+				texel[c*2] = byte(h & 0xFF)
+				texel[c*2+1] = byte((h >> 8) & 0xFF)
+			} else {
+				if c < 3 {
+					value /= scale
+				}
+				putSnorm(texel[c*size:], value, bits)
+			}
+		}
+	}
+
+	return out
+}
@@ -9,14 +9,52 @@ struct model {
   float distance_max;
 };
 
+// Up to four meshes packed into the channels of one texture, each one with
+// its own range, unused channels decode to zero
+struct modelChannels {
+  vec3 bounding_box_min;
+  vec3 bounding_box_max;
+  vec4 distance_min;
+  vec4 distance_max;
+};
+
+// Texture coordinates of p for textures baked with "-sampling corner", the
+// default, where the first and last texels are on the bounding box
+vec3 cornerCoordinates(vec3 p, sampler3D s, vec3 bounding_box_min, vec3 bounding_box_max) {
+  vec3 c = (p - bounding_box_min) / (bounding_box_max - bounding_box_min) * (textureSize(s, 0) - 1.0) + 0.5;
+  return c / textureSize(s, 0);
+}
+
+// Texture coordinates of p for textures baked with "-sampling center", where
+// the bounding box is the outside of the texels
+vec3 centerCoordinates(vec3 p, vec3 bounding_box_min, vec3 bounding_box_max) {
+  return (p - bounding_box_min) / (bounding_box_max - bounding_box_min);
+}
+
 float sdModel(vec3 p, sampler3D s, model m) {
-  vec3 bounding_box_size = m.bounding_box_max - m.bounding_box_min;
-  vec3 bounding_box_center = (m.bounding_box_max + m.bounding_box_min) * 0.5;
+  float d = texture(s, cornerCoordinates(p, s, m.bounding_box_min, m.bounding_box_max)).r;
+
+  // unpack
+  return d * (m.distance_max - m.distance_min) + m.distance_min;
+}
+
+float sdModelCenter(vec3 p, sampler3D s, model m) {
+  float d = texture(s, centerCoordinates(p, m.bounding_box_min, m.bounding_box_max)).r;
+
+  // unpack
+  return d * (m.distance_max - m.distance_min) + m.distance_min;
+}
+
+// Distances of every mesh of a texture with packed channels
+vec4 sdModelChannels(vec3 p, sampler3D s, modelChannels m) {
+  vec4 d = texture(s, cornerCoordinates(p, s, m.bounding_box_min, m.bounding_box_max));
+
+  // unpack
+  return d * (m.distance_max - m.distance_min) + m.distance_min;
+}
 
-  // map coordinates to texture
-  vec3 c = (p - m.bounding_box_min) / bounding_box_size * (textureSize(s, 0) - 1.0) + 0.5;
-  c = c / textureSize(s, 0);
-  float d = texture(s, c).b;
+vec4 sdModelChannelsCenter(vec3 p, sampler3D s, modelChannels m) {
+  vec4 d = texture(s, centerCoordinates(p, m.bounding_box_min, m.bounding_box_max));
 
   // unpack
   return d * (m.distance_max - m.distance_min) + m.distance_min;